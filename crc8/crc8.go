@@ -0,0 +1,51 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package crc8 provides an implementation of the Dallas/Maxim 1-Wire CRC8.
+package crc8
+
+// Populate the package's lookup table for the polynomial x^8 + x^5 + x^4 + 1.
+func makeTable() (table [256]byte) {
+
+	for i := range table {
+		crc := byte(i)
+		for bit := 0; bit < 8; bit++ {
+			if crc&0x01 != 0 {
+				crc = crc>>1 ^ 0x8C
+			} else {
+				crc >>= 1
+			}
+		}
+		table[i] = crc
+	}
+
+	return
+}
+
+// Precalculated polynomial table
+var table = makeTable()
+
+// Checksum returns the CRC8 checksum for the given byte array
+func Checksum(bytes []byte) byte {
+
+	crc := byte(0x00)
+	for _, bt := range bytes {
+		crc = table[crc^bt]
+	}
+
+	return crc
+}
@@ -19,11 +19,11 @@
 
 ibutton provides access to Maxim iButton devices
 
-	ibutton -command start
-	ibutton -command stop
-	ibutton -command read
-	ibutton -command status
-	ibutton -command clear
+	ibutton start
+	ibutton stop
+	ibutton read
+	ibutton status
+	ibutton clear
 
 */
 package documentation
@@ -0,0 +1,740 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+// Package emulator provides an in-process emulation of DS1922/DS1923 iButtons
+// which a w1.Button can talk to through the emulated bus.
+package emulator
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/maxhille/go-ibutton/crc16"
+	"github.com/maxhille/go-ibutton/crc8"
+	"github.com/maxhille/go-ibutton/w1"
+	"math"
+	"sync"
+	"time"
+)
+
+// Bus is an emulated 1-Wire bus. It implements w1.Transport.
+type Bus struct {
+	mu       sync.Mutex
+	devices  []*Device
+	selected *Device
+}
+
+// NewBus returns a bus with the given devices attached
+func NewBus(devices ...*Device) *Bus {
+
+	return &Bus{devices: devices}
+}
+
+// Reset terminates the selected device's command in progress
+func (b *Bus) Reset() (err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.selected != nil {
+		b.selected.reset()
+		b.selected = nil
+	}
+
+	return
+}
+
+// Search returns the ROM ids of the attached devices
+func (b *Bus) Search() (roms []w1.ROM, err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, device := range b.devices {
+		roms = append(roms, device.rom)
+	}
+
+	return
+}
+
+// Select addresses the device with the given ROM id
+func (b *Bus) Select(rom w1.ROM) (err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.selected != nil {
+		b.selected.reset()
+		b.selected = nil
+	}
+
+	for _, device := range b.devices {
+		if device.rom == rom {
+			b.selected = device
+			return
+		}
+	}
+
+	return fmt.Errorf("no device with ROM id %v on the bus", rom)
+}
+
+// Write sends a command to the selected device
+func (b *Bus) Write(data []byte) (err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.selected == nil {
+		return errors.New("no device selected")
+	}
+
+	return b.selected.write(data)
+}
+
+// Read reads the selected device's response
+func (b *Bus) Read(data []byte) (err error) {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.selected == nil {
+		return errors.New("no device selected")
+	}
+
+	b.selected.read(data)
+
+	return
+}
+
+// Close does nothing, the emulated bus needs no cleanup
+func (b *Bus) Close() (err error) {
+
+	return
+}
+
+// register addresses
+const (
+	rtcRegister            = 0x0200
+	sampleRateRegister     = 0x0206
+	lowAlarmThreshold      = 0x0208
+	highAlarmThreshold     = 0x0209
+	latestTemperature      = 0x020C
+	temperatureAlarmEnable = 0x0210
+	rtcControlRegister     = 0x0212
+	missionControlRegister = 0x0213
+	alarmStatusRegister    = 0x0214
+	generalStatusRegister  = 0x0215
+	startDelayRegister     = 0x0216
+	missionTimestamp       = 0x0219
+	missionSamplesCounter  = 0x0220
+	deviceSamplesCounter   = 0x0223
+	deviceConfiguration    = 0x0226
+	passwordControl        = 0x0227
+	readAccessPassword     = 0x0228
+	fullAccessPassword     = 0x0230
+	calibrationRegister    = 0x0240
+	humidityCalibration    = 0x0248
+	logMemory              = 0x1000
+	memorySize             = 0x3000
+)
+
+// register bits
+const (
+	eosc   = 0x01 << 0
+	ehss   = 0x01 << 1
+	etl    = 0x01 << 0
+	ehl    = 0x01 << 1
+	tlfs   = 0x01 << 2
+	hlfs   = 0x01 << 3
+	ro     = 0x01 << 4
+	suta   = 0x01 << 5
+	mip    = 0x01 << 1
+	memclr = 0x01 << 3
+	wfta   = 0x01 << 4
+	etla   = 0x01 << 0
+	etha   = 0x01 << 1
+	tlf    = 0x01 << 0
+	thf    = 0x01 << 1
+	aa     = 0x01 << 7
+)
+
+// device specific temperature data: offset of the raw value 0, from the
+// temperature conversion formulas of the data sheets (e.g. DS1922E:
+// T = TRH/2 + 14 + TRL/512), and the calibration reference points Tr2, Tr3
+var models = map[byte]struct {
+	offset float64
+	tr2    float64
+	tr3    float64
+}{
+	w1.DS1922L: {-41.0, -10.0, 25.0},
+	w1.DS1922T: {-1.0, 25.0, 60.0},
+	w1.DS1922E: {14.0, 40.0, 90.0},
+	w1.DS1923:  {-41.0, -10.0, 25.0},
+}
+
+// humidity calibration reference points in %RH, in register order (Hr2, Hr3, Hr1)
+var humidityReferences = []float64{60.0, 90.0, 20.0}
+
+// Device is an emulated DS1922 iButton
+type Device struct {
+
+	// Now is the emulated device's notion of host time, time.Now if nil
+	Now func() time.Time
+
+	// Temperature gives the sensor temperature in °C at the given time, 20°C if nil
+	Temperature func(time.Time) float64
+
+	// Humidity gives the DS1923 sensor humidity in %RH at the given time, 50%RH if nil
+	Humidity func(time.Time) float64
+
+	// Drift is the RTC frequency error in ppm, a positive drift runs fast
+	Drift float64
+
+	rom        w1.ROM
+	model      byte
+	memory     [memorySize]byte
+	scratchpad [32]byte
+	target     uint16
+	es         byte
+
+	// the RTC value (wall clock, kept in UTC), the host time it was set at
+	// and the hour mode it was set in
+	rtc    time.Time
+	rtcAt  time.Time
+	hour12 bool
+
+	// the host time of the first conversion (mission start plus delay), the
+	// conversions skipped waiting for a temperature alarm and the samples
+	// logged since
+	missionStart time.Time
+	skipped      uint32
+	logged       uint32
+
+	// pending response bytes and, during READ_MEMORY, the next page address
+	output  []byte
+	address int
+	reading bool
+}
+
+// NewDevice returns an emulated device of the given model (e.g. w1.DS1922L)
+// and serial number with a cleared memory
+func NewDevice(model byte, serial uint64) *Device {
+
+	d := &Device{model: model}
+
+	// ROM id
+	d.rom[0] = w1.FAMILY
+	for i := 1; i < 7; i++ {
+		d.rom[i] = byte(serial >> (uint(i-1) * 8))
+	}
+	d.rom[7] = crc8.Checksum(d.rom[:7])
+
+	// registers
+	d.memory[missionControlRegister] = 0xC0
+	d.memory[generalStatusRegister] = memclr
+	d.memory[deviceConfiguration] = model
+	d.memory[0x0211] = 0xFC
+
+	// factory calibration without any error
+	m := models[model]
+	copy(d.memory[calibrationRegister:], d.encodeTemp(m.tr2, true))
+	copy(d.memory[calibrationRegister+2:], d.encodeTemp(m.tr2, true))
+	copy(d.memory[calibrationRegister+4:], d.encodeTemp(m.tr3, true))
+	copy(d.memory[calibrationRegister+6:], d.encodeTemp(m.tr3, true))
+	if model == w1.DS1923 {
+		for i, rh := range humidityReferences {
+			raw := encodeHumidity(rh, 25.0, true)
+			copy(d.memory[humidityCalibration+i*4:], raw)
+			copy(d.memory[humidityCalibration+i*4+2:], raw)
+		}
+	}
+
+	return d
+}
+
+// ROM the device's ROM id
+func (d *Device) ROM() w1.ROM {
+
+	return d.rom
+}
+
+// SetClock sets and starts the device clock to the wall clock of the given
+// time, in 12 or 24 hour mode, as if it had been set by another program
+func (d *Device) SetClock(t time.Time, hour12 bool) {
+
+	d.rtc = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	d.rtcAt = d.now()
+	d.hour12 = hour12
+	d.memory[rtcControlRegister] |= eosc
+}
+
+// now the current host time
+func (d *Device) now() time.Time {
+
+	if d.Now == nil {
+		return time.Now()
+	}
+
+	return d.Now()
+}
+
+// temperature the sensor temperature at the given time
+func (d *Device) temperature(t time.Time) float64 {
+
+	if d.Temperature == nil {
+		return 20.0
+	}
+
+	return d.Temperature(t)
+}
+
+// humidity the sensor humidity at the given time
+func (d *Device) humidity(t time.Time) float64 {
+
+	if d.Humidity == nil {
+		return 50.0
+	}
+
+	return d.Humidity(t)
+}
+
+// reset terminates the command in progress
+func (d *Device) reset() {
+
+	d.output = nil
+	d.reading = false
+}
+
+// read hands out the pending response, continuing READ_MEMORY page by page
+func (d *Device) read(data []byte) {
+
+	for i := range data {
+		if len(d.output) == 0 && d.reading {
+			d.output = d.page(nil)
+		}
+		if len(d.output) == 0 {
+			data[i] = 0xFF
+			continue
+		}
+		data[i] = d.output[0]
+		d.output = d.output[1:]
+	}
+}
+
+// page returns the memory page at the current read address followed by
+// the inverted CRC16 over the given prefix and the page data
+func (d *Device) page(prefix []byte) []byte {
+
+	end := (d.address | 0x1F) + 1
+	data := make([]byte, 0, len(prefix)+end-d.address+2)
+	data = append(data, prefix...)
+	for ; d.address < end; d.address++ {
+		data = append(data, d.readByte(d.address))
+	}
+	crc := 0xFFFF ^ crc16.Checksum(data)
+
+	return append(data[len(prefix):], byte(crc), byte(crc>>8))
+}
+
+// readByte reads a single byte from the memory map
+func (d *Device) readByte(address int) byte {
+
+	switch {
+	case address >= memorySize:
+		return 0xFF
+	case address >= rtcRegister && address < rtcRegister+6:
+		return encodeTime(d.clock(), d.hour12)[address-rtcRegister]
+	case address >= readAccessPassword && address < fullAccessPassword+8:
+		// passwords are write-only
+		return 0x00
+	}
+
+	return d.memory[address]
+}
+
+// write executes the given command
+func (d *Device) write(data []byte) (err error) {
+
+	d.reset()
+	d.update()
+
+	if len(data) == 0 {
+		return
+	}
+
+	switch data[0] {
+	case w1.WRITE_SCRATCHPAD:
+		if len(data) < 3 {
+			return errors.New("short WRITE_SCRATCHPAD command")
+		}
+		d.target = uint16(data[1]) | uint16(data[2])<<8
+		offset := int(d.target & 0x1F)
+		n := copy(d.scratchpad[offset:], data[3:])
+		d.es = byte(offset + n - 1)
+	case w1.READ_SCRATCHPAD:
+		response := []byte{byte(d.target), byte(d.target >> 8), d.es}
+		response = append(response, d.scratchpad[d.target&0x1F:d.es&0x1F+1]...)
+		crc := 0xFFFF ^ crc16.Checksum(append([]byte{w1.READ_SCRATCHPAD}, response...))
+		d.output = append(response, byte(crc), byte(crc>>8))
+	case w1.COPY_SCRATCHPAD:
+		if len(data) < 12 {
+			return errors.New("short COPY_SCRATCHPAD command")
+		}
+		if data[1] != byte(d.target) || data[2] != byte(d.target>>8) || data[3] != d.es&0x1F {
+			return
+		}
+		if !d.access(data[4:12], true) {
+			return
+		}
+		d.copyScratchpad()
+	case w1.READ_MEMORY:
+		if len(data) < 11 {
+			return errors.New("short READ_MEMORY command")
+		}
+		if !d.access(data[3:11], false) {
+			return
+		}
+		d.address = int(data[1]) | int(data[2])<<8
+		d.output = d.page(data[:3])
+		d.reading = true
+	case w1.CLEAR_MEMORY, w1.START_MISSION, w1.STOP_MISSION:
+		if len(data) < 10 {
+			return errors.New("short mission command")
+		}
+		if !d.access(data[1:9], true) {
+			return
+		}
+		d.mission(data[0])
+	}
+
+	return
+}
+
+// mission executes the given mission command
+func (d *Device) mission(command byte) {
+
+	switch command {
+	case w1.CLEAR_MEMORY:
+		if d.memory[generalStatusRegister]&mip != 0 {
+			return
+		}
+		for i := missionTimestamp; i < deviceSamplesCounter; i++ {
+			d.memory[i] = 0x00
+		}
+		d.memory[alarmStatusRegister] = 0x00
+		d.memory[generalStatusRegister] |= memclr
+	case w1.START_MISSION:
+		if d.memory[generalStatusRegister]&(mip|memclr) != memclr {
+			return
+		}
+		d.memory[generalStatusRegister] |= mip
+		d.memory[generalStatusRegister] &^= memclr
+		if d.memory[missionControlRegister]&suta != 0 {
+			d.memory[generalStatusRegister] |= wfta
+		}
+		delay := time.Duration(getCounter(d.memory[startDelayRegister:])) * time.Minute
+		d.missionStart = d.now().Add(d.hostDuration(delay))
+		d.skipped, d.logged = 0, 0
+		d.update()
+	case w1.STOP_MISSION:
+		d.memory[generalStatusRegister] &^= mip | wfta
+	}
+}
+
+// access checks the given password if password protection is enabled. Full
+// access needs the full access password, read access takes either password.
+func (d *Device) access(password []byte, full bool) bool {
+
+	if d.memory[passwordControl] != w1.PASSWORDS_ENABLED {
+		return true
+	}
+
+	if bytes.Equal(password, d.memory[fullAccessPassword:fullAccessPassword+8]) {
+		return true
+	}
+
+	return !full && bytes.Equal(password, d.memory[readAccessPassword:readAccessPassword+8])
+}
+
+// copyScratchpad copies the scratchpad into the memory map, skipping read-only registers
+func (d *Device) copyScratchpad() {
+
+	d.es |= aa
+
+	// registers are write protected during a mission
+	if d.target >= rtcRegister && d.memory[generalStatusRegister]&mip != 0 {
+		return
+	}
+
+	for address := int(d.target); address <= int(d.target&^0x1F)+int(d.es&0x1F); address++ {
+		switch {
+		case address >= latestTemperature && address < temperatureAlarmEnable:
+		case address >= alarmStatusRegister && address < startDelayRegister:
+		case address >= missionTimestamp && address < 0x0227:
+		case address >= 0x0238:
+		default:
+			d.memory[address] = d.scratchpad[address&0x1F]
+		}
+	}
+
+	// setting the clock
+	if d.target == rtcRegister {
+		d.rtc = decodeTime(d.scratchpad[:6])
+		d.rtcAt = d.now()
+		d.hour12 = d.scratchpad[2]&w1.RTC_12_HOUR != 0
+	}
+}
+
+// clock the current RTC value
+func (d *Device) clock() time.Time {
+
+	if d.memory[rtcControlRegister]&eosc == 0 {
+		return d.rtc
+	}
+
+	return d.rtc.Add(d.deviceDuration(d.now().Sub(d.rtcAt)))
+}
+
+// deviceDuration the time the drifting RTC counts during the given host duration
+func (d *Device) deviceDuration(host time.Duration) time.Duration {
+
+	return host + time.Duration(float64(host)*d.Drift/1e6)
+}
+
+// hostDuration the host duration the drifting RTC needs to count the given time
+func (d *Device) hostDuration(device time.Duration) time.Duration {
+
+	return time.Duration(float64(device) / (1 + d.Drift/1e6))
+}
+
+// sampleRate the mission sample rate
+func (d *Device) sampleRate() time.Duration {
+
+	rate := time.Duration(d.memory[sampleRateRegister]) | time.Duration(d.memory[sampleRateRegister+1]&0x3F)<<8
+	if d.memory[rtcControlRegister]&ehss != 0 {
+		return rate * time.Second
+	}
+
+	return rate * time.Minute
+}
+
+// update logs all samples which came due since the last update
+func (d *Device) update() {
+
+	if d.memory[generalStatusRegister]&mip == 0 {
+		return
+	}
+
+	// the start delay counts down in minutes
+	elapsed := d.deviceDuration(d.now().Sub(d.missionStart))
+	if elapsed < 0 {
+		putCounter(d.memory[startDelayRegister:], uint32((-elapsed+time.Minute-1)/time.Minute))
+		return
+	}
+	putCounter(d.memory[startDelayRegister:], 0)
+
+	rate := d.sampleRate()
+	if rate <= 0 {
+		return
+	}
+	due := uint32(elapsed/rate) + 1
+
+	for d.skipped+d.logged < due {
+		t := d.missionStart.Add(d.hostDuration(rate * time.Duration(d.skipped+d.logged)))
+		temperature := d.temperature(t)
+
+		// SUTA missions log from the first conversion with an alarm on
+		alarmed := d.alarm(temperature)
+		if d.memory[generalStatusRegister]&wfta != 0 {
+			if !alarmed {
+				d.skipped++
+				continue
+			}
+			d.memory[generalStatusRegister] &^= wfta
+		}
+
+		if d.logged == 0 {
+			copy(d.memory[missionTimestamp:], encodeTime(d.clock().Add(d.deviceDuration(t.Sub(d.now()))), d.hour12))
+		}
+		if d.log(d.logged, temperature, d.humidity(t)) {
+			putCounter(d.memory[missionSamplesCounter:], d.logged+1)
+			putCounter(d.memory[deviceSamplesCounter:], getCounter(d.memory[deviceSamplesCounter:])+1)
+		}
+		d.logged++
+	}
+}
+
+// alarm raises the temperature alarm flags for the given sample, true if
+// an enabled alarm went off
+func (d *Device) alarm(temperature float64) (alarmed bool) {
+
+	value := d.encodeTemp(temperature, false)[0]
+	enable := d.memory[temperatureAlarmEnable]
+
+	if enable&etla != 0 && value <= d.memory[lowAlarmThreshold] {
+		d.memory[alarmStatusRegister] |= tlf
+		alarmed = true
+	}
+	if enable&etha != 0 && value >= d.memory[highAlarmThreshold] {
+		d.memory[alarmStatusRegister] |= thf
+		alarmed = true
+	}
+
+	return
+}
+
+// log stores the sample with the given index, false if the memory is full.
+// The log memory is split in halves when both channels are logged.
+func (d *Device) log(index uint32, temperature float64, humidity float64) bool {
+
+	control := d.memory[missionControlRegister]
+	temperatureSize, humiditySize := uint32(1), uint32(1)
+	if control&tlfs != 0 {
+		temperatureSize = 2
+	}
+	if control&hlfs != 0 {
+		humiditySize = 2
+	}
+
+	size := uint32(memorySize - logMemory)
+	if control&etl != 0 && control&ehl != 0 {
+		size /= 2
+	}
+	capacity := size
+	if control&etl != 0 {
+		capacity = size / temperatureSize
+	}
+	if control&ehl != 0 && size/humiditySize < capacity {
+		capacity = size / humiditySize
+	}
+	if index >= capacity && control&ro == 0 {
+		return false
+	}
+
+	address := uint32(logMemory)
+	if control&etl != 0 {
+		copy(d.memory[address+(index%capacity)*temperatureSize:], d.encodeTemp(temperature, control&tlfs != 0))
+		address += size
+	}
+	if control&ehl != 0 {
+		copy(d.memory[address+(index%capacity)*humiditySize:], encodeHumidity(humidity, temperature, control&hlfs != 0))
+	}
+
+	return true
+}
+
+// encodeTemp encodes the given temperature as stored by the device
+func (d *Device) encodeTemp(temperature float64, highResolution bool) []byte {
+
+	raw := math.Max((temperature-models[d.model].offset)*512, 0)
+
+	if highResolution {
+		value := uint16(math.Min(raw+16, 0xFFFF)) &^ 0x1F
+		return []byte{byte(value >> 8), byte(value)}
+	}
+
+	return []byte{byte(math.Min((raw+128)/256, 0xFF))}
+}
+
+// encodeHumidity encodes the given humidity as measured by the sensor at the
+// given temperature
+func encodeHumidity(humidity float64, temperature float64, highResolution bool) []byte {
+
+	// the sensor reads the uncompensated humidity
+	uncompensated := humidity * (1.0546 - 0.00216*temperature)
+	adval := math.Max((uncompensated*0.0307+0.958)*4096/5.02, 0)
+
+	if highResolution {
+		value := uint16(math.Min(adval*16+0.5, 0xFFFF))
+		return []byte{byte(value >> 8), byte(value)}
+	}
+
+	return []byte{byte(math.Min(adval/16+0.5, 0xFF))}
+}
+
+// getCounter reads a 24 bit little endian counter
+func getCounter(bytes []byte) uint32 {
+
+	return uint32(bytes[0]) | uint32(bytes[1])<<8 | uint32(bytes[2])<<16
+}
+
+// putCounter writes a 24 bit little endian counter
+func putCounter(bytes []byte, value uint32) {
+
+	bytes[0] = byte(value)
+	bytes[1] = byte(value >> 8)
+	bytes[2] = byte(value >> 16)
+}
+
+// bcd encodes the given value in binary coded decimal
+func bcd(value int) byte {
+
+	return byte(value/10<<4 | value%10)
+}
+
+// unbcd decodes the given binary coded decimal
+func unbcd(value byte) int {
+
+	return int(value>>4)*10 + int(value&0x0F)
+}
+
+// encodeTime encodes the wall clock of the given time in the RTC register
+// format, in 12 or 24 hour mode
+func encodeTime(t time.Time, hour12 bool) []byte {
+
+	hours := bcd(t.Hour())
+	if hour12 {
+		hours = w1.RTC_12_HOUR | bcd((t.Hour()+11)%12+1)
+		if t.Hour() >= 12 {
+			hours |= w1.RTC_PM
+		}
+	}
+
+	month := bcd(int(t.Month()))
+	if t.Year() >= 2100 {
+		month |= w1.RTC_CENTURY
+	}
+
+	return []byte{
+		bcd(t.Second()),
+		bcd(t.Minute()),
+		hours,
+		bcd(t.Day()),
+		month,
+		bcd(t.Year() % 100),
+	}
+}
+
+// decodeTime decodes a wall clock time from the RTC register format
+func decodeTime(bytes []byte) time.Time {
+
+	hour := unbcd(bytes[2] & 0x3F)
+	if bytes[2]&w1.RTC_12_HOUR != 0 {
+		hour = unbcd(bytes[2]&0x1F) % 12
+		if bytes[2]&w1.RTC_PM != 0 {
+			hour += 12
+		}
+	}
+
+	year := 2000 + unbcd(bytes[5])
+	if bytes[4]&w1.RTC_CENTURY != 0 {
+		year += 100
+	}
+
+	return time.Date(year, time.Month(unbcd(bytes[4]&0x1F)), unbcd(bytes[3]&0x3F),
+		hour, unbcd(bytes[1]&0x7F), unbcd(bytes[0]&0x7F), 0, time.UTC)
+}
@@ -0,0 +1,45 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package emulator_test
+
+import (
+	"fmt"
+	"github.com/maxhille/go-ibutton/emulator"
+	"github.com/maxhille/go-ibutton/w1"
+	"time"
+)
+
+func Example() {
+	device := emulator.NewDevice(w1.DS1922L, 0x1234)
+	device.Temperature = func(time.Time) float64 { return 4.5 }
+
+	button := w1.NewButton(emulator.NewBus(device), device.ROM())
+	button.StartMission(w1.DefaultMissionConfig)
+
+	status, _ := button.Status()
+	fmt.Printf("%v %v running: %v\n", button.ROM(), status.Name(), status.MissionInProgress())
+
+	samples, _ := button.ReadLog()
+	for _, sample := range samples {
+		fmt.Printf("%3.3f°C\n", sample.Temp)
+	}
+
+	// Output:
+	// 41-000000001234 DS1922L running: true
+	// 4.500°C
+}
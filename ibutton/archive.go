@@ -0,0 +1,370 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/maxhille/go-ibutton/w1"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// missionIDPattern matches the Status.MissionID of a mission
+var missionIDPattern = regexp.MustCompile("^[0-9]{14}$")
+
+// archive is a directory of downloaded missions, a directory per iButton
+// ROM id with a JSON file per mission, named after its Status.MissionID.
+// Repeated downloads of the same mission are merged into its file.
+type archive string
+
+// defaultArchiveDir is ibutton/archive in the user's data directory
+func defaultArchiveDir() string {
+
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "archive"
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+
+	return filepath.Join(dir, "ibutton", "archive")
+}
+
+// archivedMission is the log of a mission with the times it was downloaded.
+// It is stored in the format of the read command's JSON output.
+type archivedMission struct {
+	logHeader
+	Mission   string      `json:"mission"`
+	Downloads []string    `json:"downloads"`
+	Samples   []logSample `json:"samples"`
+}
+
+// ROM returns the ROM id of the mission's iButton
+func (m *archivedMission) ROM() w1.ROM {
+
+	rom, _ := w1.ParseROM(m.logHeader.ROM)
+
+	return rom
+}
+
+// Name returns the model of the mission's iButton
+func (m *archivedMission) Name() string {
+
+	return m.Model
+}
+
+// MissionTimestamp returns the mission start
+func (m *archivedMission) MissionTimestamp() time.Time {
+
+	t, _ := time.Parse(time.RFC3339Nano, m.MissionStart)
+
+	return t
+}
+
+// SampleRate returns the time between two samples
+func (m *archivedMission) SampleRate() time.Duration {
+
+	return time.Duration(m.logHeader.SampleRate * float64(time.Second))
+}
+
+// Drift returns the clock drift measured by the latest download
+func (m *archivedMission) Drift() time.Duration {
+
+	return time.Duration(m.ClockDrift * float64(time.Second))
+}
+
+// TemperatureLogging tells if the mission logs temperatures
+func (m *archivedMission) TemperatureLogging() bool {
+
+	return m.Units["temperature"] != ""
+}
+
+// HumidityLogging tells if the mission logs humidities
+func (m *archivedMission) HumidityLogging() bool {
+
+	return m.Units["humidity"] != ""
+}
+
+// samples returns the archived samples
+func (m *archivedMission) samples() (samples []w1.Sample, err error) {
+
+	samples = make([]w1.Sample, len(m.Samples))
+	for i, in := range m.Samples {
+		samples[i].Time, err = time.Parse(time.RFC3339Nano, in.Time)
+		if err != nil {
+			return
+		}
+		if in.Temperature != "" {
+			value, err := strconv.ParseFloat(in.Temperature.String(), 32)
+			if err != nil {
+				return nil, err
+			}
+			samples[i].Temp = w1.Temperature(value)
+		}
+		if in.Humidity != "" {
+			value, err := strconv.ParseFloat(in.Humidity.String(), 32)
+			if err != nil {
+				return nil, err
+			}
+			samples[i].Humidity = w1.Humidity(value)
+		}
+	}
+
+	return
+}
+
+// merge adds the samples the mission does not have yet, in time order
+func (m *archivedMission) merge(samples []logSample) (added int, err error) {
+
+	times := make(map[int64]bool, len(m.Samples))
+	for _, sample := range m.Samples {
+		t, err := time.Parse(time.RFC3339Nano, sample.Time)
+		if err != nil {
+			return 0, err
+		}
+		times[t.UnixNano()] = true
+	}
+
+	for _, sample := range samples {
+		t, err := time.Parse(time.RFC3339Nano, sample.Time)
+		if err != nil {
+			return added, err
+		}
+		if times[t.UnixNano()] {
+			continue
+		}
+		times[t.UnixNano()] = true
+		m.Samples = append(m.Samples, sample)
+		added++
+	}
+
+	sort.SliceStable(m.Samples, func(i, j int) bool {
+		a, _ := time.Parse(time.RFC3339Nano, m.Samples[i].Time)
+		b, _ := time.Parse(time.RFC3339Nano, m.Samples[j].Time)
+		return a.Before(b)
+	})
+
+	return
+}
+
+// path returns the file of the given iButton's mission
+func (a archive) path(rom w1.ROM, mission string) string {
+
+	return filepath.Join(string(a), rom.String(), mission+".json")
+}
+
+// rebase moves the sample times to the given mission start. Downloads read
+// with another time zone place the same mission at another instant.
+func (m *archivedMission) rebase(start time.Time) (err error) {
+
+	delta := start.Sub(m.MissionTimestamp())
+	if delta == 0 {
+		return
+	}
+
+	for i, sample := range m.Samples {
+		t, err := time.Parse(time.RFC3339Nano, sample.Time)
+		if err != nil {
+			return err
+		}
+		m.Samples[i].Time = t.Add(delta).In(start.Location()).Format(time.RFC3339Nano)
+	}
+
+	return
+}
+
+// store merges a download of the given mission into the archive, returning
+// the number of samples the archive did not have
+func (a archive) store(status *w1.Status, samples []w1.Sample, downloaded time.Time) (added int, err error) {
+
+	if status.MissionID() == "" {
+		return 0, fmt.Errorf("no mission to archive")
+	}
+
+	path := a.path(status.ROM(), status.MissionID())
+	m, err := readArchivedMission(path)
+	switch {
+	case os.IsNotExist(err):
+		m = new(archivedMission)
+	case err != nil:
+		return
+	default:
+		err = m.rebase(status.MissionTimestamp())
+		if err != nil {
+			return
+		}
+	}
+
+	// the latest download describes the mission
+	m.logHeader = newLogHeader(status)
+	m.Mission = status.MissionID()
+	m.Downloads = append(m.Downloads, downloaded.Format(time.RFC3339Nano))
+
+	in := make([]logSample, len(samples))
+	for i, sample := range samples {
+		in[i] = newLogSample(status, sample)
+	}
+	added, err = m.merge(in)
+	if err != nil {
+		return
+	}
+
+	err = writeArchivedMission(path, m)
+
+	return
+}
+
+// missions returns the archived missions, by ROM id and mission ID
+func (a archive) missions() (missions []*archivedMission, err error) {
+
+	paths, err := filepath.Glob(filepath.Join(string(a), "*", "*.json"))
+	if err != nil {
+		return
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		m, err := readArchivedMission(path)
+		if err != nil {
+			return nil, err
+		}
+		missions = append(missions, m)
+	}
+
+	return
+}
+
+// find returns the archived mission of the given ROM id with the given
+// mission ID, or the latest one if mission is empty
+func (a archive) find(id string, mission string) (m *archivedMission, err error) {
+
+	rom, err := w1.ParseROM(id)
+	if err != nil {
+		return
+	}
+
+	if mission == "" {
+		paths, err := filepath.Glob(filepath.Join(string(a), rom.String(), "*.json"))
+		if err != nil {
+			return nil, err
+		}
+		if len(paths) == 0 {
+			return nil, fmt.Errorf("no archived missions of %v", rom)
+		}
+		sort.Strings(paths)
+		return readArchivedMission(paths[len(paths)-1])
+	}
+
+	if !missionIDPattern.MatchString(mission) {
+		return nil, fmt.Errorf("invalid mission %q, want e.g. 20130401153000", mission)
+	}
+	m, err = readArchivedMission(a.path(rom, mission))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("no archived mission %v of %v", mission, rom)
+	}
+
+	return
+}
+
+// readArchivedMission reads the archived mission of the given file
+func readArchivedMission(path string) (m *archivedMission, err error) {
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	m = new(archivedMission)
+	err = json.Unmarshal(data, m)
+	if err != nil {
+		return nil, fmt.Errorf("invalid archive file %v (%v)", path, err)
+	}
+
+	return
+}
+
+// writeArchivedMission replaces the given file with the archived mission,
+// leaving the old file in place if writing fails
+func writeArchivedMission(path string, m *archivedMission) (err error) {
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return
+	}
+
+	err = os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return
+	}
+
+	temp := path + ".tmp"
+	err = os.WriteFile(temp, append(data, '\n'), 0644)
+	if err != nil {
+		return
+	}
+
+	return os.Rename(temp, path)
+}
+
+// writeArchiveList writes a line per archived mission
+func writeArchiveList(w io.Writer, missions []*archivedMission) {
+
+	for _, m := range missions {
+		first, last := "-", "-"
+		if len(m.Samples) > 0 {
+			first, last = m.Samples[0].Time, m.Samples[len(m.Samples)-1].Time
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v samples\t%v to %v\t%v downloads\n",
+			m.logHeader.ROM, m.Mission, m.Model, len(m.Samples), first, last, len(m.Downloads))
+	}
+}
+
+// writeArchiveShow writes the description of an archived mission
+func writeArchiveShow(w io.Writer, m *archivedMission) {
+
+	var logged []string
+	if m.TemperatureLogging() {
+		logged = append(logged, "temperature")
+	}
+	if m.HumidityLogging() {
+		logged = append(logged, "humidity")
+	}
+
+	fmt.Fprintf(w, "rom:       %v\n", m.logHeader.ROM)
+	fmt.Fprintf(w, "model:     %v\n", m.Model)
+	fmt.Fprintf(w, "mission:   %v\n", m.Mission)
+	fmt.Fprintf(w, "start:     %v\n", m.MissionStart)
+	fmt.Fprintf(w, "rate:      %v\n", m.SampleRate())
+	fmt.Fprintf(w, "drift:     %v\n", m.Drift())
+	fmt.Fprintf(w, "logging:   %v\n", strings.Join(logged, ", "))
+	fmt.Fprintf(w, "samples:   %v\n", len(m.Samples))
+	if len(m.Samples) > 0 {
+		fmt.Fprintf(w, "first:     %v\n", m.Samples[0].Time)
+		fmt.Fprintf(w, "last:      %v\n", m.Samples[len(m.Samples)-1].Time)
+	}
+	fmt.Fprintf(w, "downloads: %v\n", strings.Join(m.Downloads, ", "))
+}
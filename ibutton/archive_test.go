@@ -0,0 +1,118 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"github.com/maxhille/go-ibutton/w1"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchive(t *testing.T) {
+	button := emulatedButton(t)
+	status, samples := download(t, button)
+	if len(samples) < 2 {
+		t.Fatalf("ReadLog() returned %v samples, want at least 2", len(samples))
+	}
+	a := archive(t.TempDir())
+	downloaded := time.Date(2013, 4, 1, 16, 0, 0, 0, time.UTC)
+
+	added, err := a.store(status, samples, downloaded)
+	if err != nil || added != len(samples) {
+		t.Fatalf("store() = %v, %v, want %v, nil", added, err, len(samples))
+	}
+
+	// a later download in another time zone is the same mission at another
+	// instant, overlapping the first download but missing its oldest sample
+	first := status.MissionTimestamp()
+	button.SetLocation(time.FixedZone("UTC+5", 5*60*60))
+	status, samples = download(t, button)
+	if status.MissionTimestamp().Equal(first) {
+		t.Fatalf("MissionTimestamp() = %v in both time zones", first)
+	}
+	next := samples[len(samples)-1]
+	next.Time = next.Time.Add(status.SampleRate())
+	later := append(append([]w1.Sample{}, samples[1:]...), next)
+	added, err = a.store(status, later, downloaded.Add(time.Hour))
+	if err != nil || added != 1 {
+		t.Fatalf("store() again = %v, %v, want 1, nil", added, err)
+	}
+
+	missions, err := a.missions()
+	if err != nil || len(missions) != 1 {
+		t.Fatalf("missions() = %v, %v, want one mission", len(missions), err)
+	}
+	m, err := a.find(status.ROM().String(), "")
+	if err != nil {
+		t.Fatalf("find() = %v", err)
+	}
+	if m.Mission != status.MissionID() || len(m.Downloads) != 2 || m.ROM() != status.ROM() ||
+		m.SampleRate() != status.SampleRate() || !m.MissionTimestamp().Equal(status.MissionTimestamp()) {
+		t.Errorf("find() = %v %+v", m.Mission, m.logHeader)
+	}
+
+	merged, err := m.samples()
+	if err != nil {
+		t.Fatalf("samples() = %v", err)
+	}
+	want := append(append([]w1.Sample{}, samples...), next)
+	if len(merged) != len(want) {
+		t.Fatalf("samples() returned %v samples, want %v", len(merged), len(want))
+	}
+	for i := range want {
+		if !merged[i].Time.Equal(want[i].Time) || merged[i].Temp != want[i].Temp || merged[i].Humidity != want[i].Humidity {
+			t.Errorf("sample %v = %+v, want %+v", i, merged[i], want[i])
+		}
+	}
+
+	var out bytes.Buffer
+	if err := writeLog(&out, "csv", m, merged); err != nil {
+		t.Fatalf("writeLog() = %v", err)
+	}
+	if x := strings.Count(out.String(), "\n"); x != 6+len(want) {
+		t.Errorf("writeLog() wrote %v lines, want %v:\n%v", x, 6+len(want), out.String())
+	}
+
+	for _, mission := range []string{status.MissionID(), "20000101000000", "yesterday"} {
+		_, err := a.find(status.ROM().String(), mission)
+		if (err == nil) != (mission == status.MissionID()) {
+			t.Errorf("find(%v) = %v", mission, err)
+		}
+	}
+}
+
+func TestArchiveMergeSubsecond(t *testing.T) {
+	start := time.Date(2013, 4, 1, 15, 30, 0, 0, time.UTC)
+	var m archivedMission
+	for _, times := range [][]time.Duration{{0, 500 * time.Millisecond}, {500 * time.Millisecond, time.Second}} {
+		var samples []logSample
+		for _, d := range times {
+			samples = append(samples, logSample{Time: start.Add(d).Format(time.RFC3339Nano)})
+		}
+		if _, err := m.merge(samples); err != nil {
+			t.Fatalf("merge() = %v", err)
+		}
+	}
+
+	// drift corrected sample times a fraction of a second apart are kept
+	if len(m.Samples) != 3 || m.Samples[1].Time != "2013-04-01T15:30:00.5Z" {
+		t.Errorf("merge() = %+v, want 3 samples half a second apart", m.Samples)
+	}
+}
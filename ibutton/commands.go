@@ -0,0 +1,582 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"github.com/maxhille/go-ibutton/w1"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+func init() {
+
+	addCommand(&command{
+		name:  "list",
+		help:  "List the iButtons on the bus with their ROM id and model.",
+		local: list,
+	}, nil)
+
+	addCommand(&command{
+		name:  "status",
+		help:  "Show the status of the iButton clock, mission and alarms.",
+		run:   readStatus,
+		image: func(image *w1.Image) error { return showStatus(image) },
+	}, func(fs *flag.FlagSet) {
+		imageFlags(fs)
+		fs.StringVar(&statusFormat, "format", "text", "output format, text, json or yaml")
+	})
+
+	addCommand(&command{
+		name:  "read",
+		help:  "Read the logged samples of the mission.",
+		run:   readSamples,
+		image: readImageLog,
+	}, func(fs *flag.FlagSet) {
+		imageFlags(fs)
+		fs.StringVar(&logFormat, "format", "text", "output format, text, csv, tsv, json or ndjson")
+		fs.BoolVar(&correctDrift, "correct-drift", false, "spread the measured iButton clock drift across the sample times")
+		fs.BoolVar(&archiveDownloads, "archive", false, "merge the downloaded mission into the archive")
+		fs.StringVar(&archiveDir, "archive-dir", defaultArchiveDir(), "archive directory")
+	})
+
+	addCommand(&command{
+		name: "start",
+		help: "Clear the memory and start a new mission.",
+		run:  startMission,
+	}, startFlags)
+	commands["start"].setup = applyProfile
+
+	addCommand(&command{
+		name:  "archive",
+		help:  "List, show or export the missions archived by the read command.\nThe mission defaults to the latest one of the iButton.",
+		args:  "list | show <rom> [mission] | export <rom> [mission]",
+		local: archiveCommand,
+	}, func(fs *flag.FlagSet) {
+		fs.StringVar(&archiveDir, "dir", defaultArchiveDir(), "archive directory")
+		fs.StringVar(&logFormat, "format", "text", "export: output format, text, csv, tsv, json or ndjson")
+	})
+
+	addCommand(&command{
+		name: "stop",
+		help: "Stop the running mission.",
+		run:  stopMission,
+	}, deviceFlags)
+
+	addCommand(&command{
+		name: "clear",
+		help: "Clear the log memory of a stopped mission.",
+		run:  clearMemory,
+	}, deviceFlags)
+
+	addCommand(&command{
+		name: "dump",
+		help: "Save the memory of the iButton to a memory image file.",
+		run:  dump,
+	}, func(fs *flag.FlagSet) {
+		deviceFlags(fs)
+		fs.StringVar(&to, "to", "", "memory image file or directory")
+	})
+
+	addCommand(&command{
+		name: "set-password",
+		help: "Set and enable the read and full access passwords.",
+		run:  setPassword,
+	}, func(fs *flag.FlagSet) {
+		deviceFlags(fs)
+		fs.StringVar(&readPassword, "read-password", "", "new read access password")
+		fs.StringVar(&fullPassword, "full-password", "", "new full access password")
+	})
+
+	addCommand(&command{
+		name: "disable-password",
+		help: "Disable the passwords.",
+		run:  disablePassword,
+	}, deviceFlags)
+}
+
+// list prints the iButtons on the bus
+func list(args []string) (err error) {
+
+	transport := new(w1.SysfsTransport)
+	defer transport.Close()
+	infos, err := w1.Enumerate(transport)
+	if err != nil {
+		return fmt.Errorf("could not list iButtons (%v)", err)
+	}
+	for _, info := range infos {
+		fmt.Printf("%v\t%v\n", info.ROM, info.Model)
+	}
+
+	return
+}
+
+// source is where status and log come from, a live iButton or a memory image
+type source interface {
+	Status() (*w1.Status, error)
+	ReadLog() ([]w1.Sample, error)
+}
+
+// buttonSource reads status and log of a live iButton with a context
+type buttonSource struct {
+	ctx    context.Context
+	button *w1.Button
+}
+
+func (s buttonSource) Status() (*w1.Status, error) {
+
+	return s.button.StatusContext(s.ctx)
+}
+
+func (s buttonSource) ReadLog() ([]w1.Sample, error) {
+
+	return s.button.ReadLogContext(s.ctx)
+}
+
+// output format of the status command
+var statusFormat string
+
+func readStatus(ctx context.Context, button *w1.Button) error {
+
+	return showStatus(buttonSource{ctx, button})
+}
+
+// showStatus prints the status of the given source
+func showStatus(source source) (err error) {
+
+	status, err := source.Status()
+	if err != nil {
+		return fmt.Errorf("could not get iButton status (%v)", err)
+	}
+	err = writeStatus(os.Stdout, statusFormat, status)
+	if err != nil {
+		return fmt.Errorf("could not write status (%v)", err)
+	}
+
+	return
+}
+
+// options of the read command
+var (
+	logFormat        string
+	correctDrift     bool
+	archiveDownloads bool
+	archiveDir       string
+)
+
+func readSamples(ctx context.Context, button *w1.Button) error {
+
+	if isTerminal(os.Stderr) {
+		button.SetProgress(newProgressBar(os.Stderr, time.Now).update)
+	}
+
+	return readLog(buttonSource{ctx, button})
+}
+
+func readImageLog(image *w1.Image) error {
+
+	return readLog(image)
+}
+
+// readLog prints the log of the given source
+func readLog(source source) (err error) {
+
+	err = checkLogFormat(logFormat)
+	if err != nil {
+		return
+	}
+	status, err := source.Status()
+	if err != nil {
+		return fmt.Errorf("could not get iButton status (%v)", err)
+	}
+	samples, err := source.ReadLog()
+	if err != nil {
+		return fmt.Errorf("could not read log (%v)", err)
+	}
+
+	// the archive keeps the samples as logged, before drift correction. A
+	// failing archive does not keep the log from being written.
+	if archiveDownloads && status.MissionID() != "" {
+		added, err := archive(archiveDir).store(status, samples, time.Now())
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "warning: could not archive mission (%v)\n", err)
+		} else {
+			fmt.Fprintf(os.Stderr, "archived %v new samples\n", added)
+		}
+	}
+
+	if correctDrift {
+		w1.CorrectDrift(status, samples)
+	}
+	switch {
+	case status.WaitingToStart():
+		fmt.Fprintf(os.Stderr, "mission waiting to start (%v left)\n", status.StartDelay())
+	case status.WaitingForAlarm():
+		fmt.Fprintf(os.Stderr, "mission waiting for temperature alarm\n")
+	}
+	err = writeLog(os.Stdout, logFormat, status, samples)
+	if err != nil {
+		return fmt.Errorf("could not write log (%v)", err)
+	}
+
+	return
+}
+
+// startFlags adds the flags of the start command
+func startFlags(fs *flag.FlagSet) {
+
+	deviceFlags(fs)
+	profileFlags(fs)
+	fs.Duration("rate", 10*time.Minute, "time between two samples (whole seconds or minutes)")
+	fs.String("channels", "temperature", "logged channels, temperature, humidity or temperature,humidity (DS1923)")
+	fs.String("resolution", "high", "temperature resolution, high (0.0625°C) or low (0.5°C)")
+	fs.String("humidity-resolution", "high", "humidity resolution, high (16 bit) or low (8 bit)")
+	fs.Bool("rollover", false, "overwrite the oldest samples when the log memory is full")
+	fs.Duration("delay", 0, "delay before the first sample (whole minutes)")
+	fs.String("at", "", "time of the first sample (e.g. 2026-11-01T06:00), instead of -delay")
+	fs.Float64("low-alarm", 0, "enable the low temperature alarm at the given °C")
+	fs.Float64("high-alarm", 0, "enable the high temperature alarm at the given °C")
+	fs.Bool("suta", false, "start logging upon a temperature alarm")
+	fs.StringVar(&readPassword, "read-password", "", "set and enable the given read access password before starting")
+	fs.StringVar(&fullPassword, "full-password", "", "set and enable the given full access password before starting")
+}
+
+// startConfig is the mission the start command programs without a profile
+// or mission flags, matching the flag defaults
+var startConfig = func() (config w1.MissionConfig) {
+
+	config = w1.DefaultMissionConfig
+	config.HumidityHighResolution = true
+
+	return
+}()
+
+func startMission(ctx context.Context, button *w1.Button) (err error) {
+
+	config := startConfig
+	if startProfile != nil {
+		config = startProfile.MissionConfig
+		if readPassword == "" && fullPassword == "" {
+			readPassword, fullPassword = startProfile.ReadPassword, startProfile.FullPassword
+		}
+	}
+
+	config, err = missionConfig(commands["start"].flags, config, button.Location())
+	if err != nil {
+		return fmt.Errorf("invalid mission parameters (%v)", err)
+	}
+
+	// passwords can only be changed while no mission is running
+	if readPassword != "" || fullPassword != "" {
+		err = enablePasswords(button)
+		if err != nil {
+			return
+		}
+	}
+
+	err = button.StartMissionContext(ctx, config)
+	if err != nil {
+		return
+	}
+	fmt.Printf("Started mission.\n")
+
+	return
+}
+
+// missionConfig applies the mission settings given as flags to the given
+// mission parameters
+func missionConfig(fs *flag.FlagSet, config w1.MissionConfig, location *time.Location) (w1.MissionConfig, error) {
+
+	var err error
+	fs.Visit(func(f *flag.Flag) {
+		if err == nil && isMissionSetting(f.Name) {
+			err = setMissionSetting(&config, f.Name, f.Value.String(), location)
+		}
+	})
+
+	return config, err
+}
+
+// missionSettings are the start flags setting mission parameters, the
+// settings a profile may hold besides the passwords
+var missionSettings = []string{"rate", "channels", "resolution", "humidity-resolution",
+	"rollover", "delay", "at", "low-alarm", "high-alarm", "suta"}
+
+// isMissionSetting tells if the given start flag sets a mission parameter
+func isMissionSetting(name string) bool {
+
+	for _, setting := range missionSettings {
+		if setting == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// setMissionSetting sets the mission parameter of the given start flag
+func setMissionSetting(config *w1.MissionConfig, name string, value string, location *time.Location) (err error) {
+
+	switch name {
+	case "rate":
+		config.SampleRate, err = time.ParseDuration(value)
+	case "channels":
+		config.LogTemperature, config.LogHumidity = false, false
+		for _, channel := range strings.Split(value, ",") {
+			switch channel {
+			case "temperature":
+				config.LogTemperature = true
+			case "humidity":
+				config.LogHumidity = true
+			default:
+				return fmt.Errorf("unknown channel %q", channel)
+			}
+		}
+	case "resolution":
+		config.HighResolution, err = parseResolution(value)
+	case "humidity-resolution":
+		config.HumidityHighResolution, err = parseResolution(value)
+	case "rollover":
+		config.Rollover, err = strconv.ParseBool(value)
+	case "delay":
+		config.StartDelay, err = time.ParseDuration(value)
+	case "at":
+		config.StartAt, err = parseStartTime(value, location)
+	case "low-alarm", "high-alarm":
+		var temp float64
+		temp, err = strconv.ParseFloat(value, 32)
+		if name == "low-alarm" {
+			config.LowAlarm, config.LowAlarmEnabled = w1.Temperature(temp), true
+		} else {
+			config.HighAlarm, config.HighAlarmEnabled = w1.Temperature(temp), true
+		}
+	case "suta":
+		config.StartUponAlarm, err = strconv.ParseBool(value)
+	default:
+		return fmt.Errorf("unknown mission setting %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid %v %q", name, value)
+	}
+
+	return
+}
+
+// parseResolution parses a high or low resolution setting
+func parseResolution(value string) (high bool, err error) {
+
+	switch value {
+	case "high":
+		return true, nil
+	case "low":
+		return false, nil
+	}
+
+	return false, fmt.Errorf("unknown resolution %q", value)
+}
+
+// startTimeLayouts are the layouts the -at flag accepts
+var startTimeLayouts = []string{"2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339}
+
+// parseStartTime parses a mission start time, in the given location unless it has a zone offset
+func parseStartTime(value string, location *time.Location) (t time.Time, err error) {
+
+	for _, layout := range startTimeLayouts {
+		t, err = time.ParseInLocation(layout, value, location)
+		if err == nil {
+			return
+		}
+	}
+
+	return t, fmt.Errorf("invalid start time %q, want e.g. 2026-11-01T06:00", value)
+}
+
+func stopMission(ctx context.Context, button *w1.Button) (err error) {
+
+	err = button.StopMissionContext(ctx)
+	if err != nil {
+		return fmt.Errorf("could not stop mission (%v)", err)
+	}
+	fmt.Printf("Stopped mission.\n")
+
+	return
+}
+
+func clearMemory(ctx context.Context, button *w1.Button) (err error) {
+
+	err = button.ClearMemoryContext(ctx)
+	if err != nil {
+		return fmt.Errorf("could not clear memory (%v)", err)
+	}
+	fmt.Printf("Cleared Memory.\n")
+
+	return
+}
+
+// memory image file or directory of the dump command
+var to string
+
+func dump(ctx context.Context, button *w1.Button) (err error) {
+
+	image, err := button.DumpContext(ctx)
+	if err != nil {
+		return fmt.Errorf("could not read memory image (%v)", err)
+	}
+	path := dumpPath(image)
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("could not create memory image file (%v)", err)
+	}
+	_, err = image.WriteTo(file)
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("could not write memory image (%v)", err)
+	}
+	err = file.Close()
+	if err != nil {
+		return fmt.Errorf("could not write memory image (%v)", err)
+	}
+	fmt.Printf("Saved memory image to %v.\n", path)
+
+	return
+}
+
+// dumpPath the file to dump the given iButton's memory image to. A -to
+// directory gets an image file named after the ROM id and read time.
+func dumpPath(image *w1.Image) string {
+
+	name := fmt.Sprintf("%v-%v.bin", image.ROM, image.Time.Format("20060102T150405"))
+
+	info, err := os.Stat(to)
+	switch {
+	case to == "":
+		return name
+	case err == nil && info.IsDir():
+		return filepath.Join(to, name)
+	}
+
+	return to
+}
+
+// passwords of the set-password command
+var (
+	readPassword string
+	fullPassword string
+)
+
+func setPassword(ctx context.Context, button *w1.Button) error {
+
+	return enablePasswords(button)
+}
+
+// enablePasswords sets and enables the -read-password and -full-password
+func enablePasswords(button *w1.Button) (err error) {
+
+	if readPassword == "" || fullPassword == "" {
+		return fmt.Errorf("both a read access and a full access password are needed")
+	}
+	read, err := w1.NewPassword(readPassword)
+	if err != nil {
+		return fmt.Errorf("invalid read access password (%v)", err)
+	}
+	full, err := w1.NewPassword(fullPassword)
+	if err != nil {
+		return fmt.Errorf("invalid full access password (%v)", err)
+	}
+	err = button.SetPasswords(read, full)
+	if err != nil {
+		return fmt.Errorf("could not set passwords (%v)", err)
+	}
+	err = button.EnablePasswords()
+	if err != nil {
+		return fmt.Errorf("could not enable passwords (%v)", err)
+	}
+	fmt.Printf("Enabled passwords.\n")
+
+	return
+}
+
+func disablePassword(ctx context.Context, button *w1.Button) (err error) {
+
+	err = button.DisablePasswords()
+	if err != nil {
+		return fmt.Errorf("could not disable passwords (%v)", err)
+	}
+	fmt.Printf("Disabled passwords.\n")
+
+	return
+}
+
+// archiveCommand runs the archive command's list, show and export
+func archiveCommand(args []string) (err error) {
+
+	if len(args) == 0 {
+		return fmt.Errorf("missing archive command, want list, show or export")
+	}
+
+	// flags may follow the archive command
+	c := commands["archive"]
+	err = c.flags.Parse(args[1:])
+	if err != nil {
+		return
+	}
+	args = append(args[:1], c.flags.Args()...)
+
+	switch {
+	case args[0] == "list" && len(args) == 1:
+		missions, err := archive(archiveDir).missions()
+		if err != nil {
+			return fmt.Errorf("could not read archive (%v)", err)
+		}
+		writeArchiveList(os.Stdout, missions)
+	case (args[0] == "show" || args[0] == "export") && (len(args) == 2 || len(args) == 3):
+		start := ""
+		if len(args) == 3 {
+			start = args[2]
+		}
+		m, err := archive(archiveDir).find(args[1], start)
+		if err != nil {
+			return fmt.Errorf("could not read archive (%v)", err)
+		}
+		if args[0] == "show" {
+			writeArchiveShow(os.Stdout, m)
+			return nil
+		}
+		err = checkLogFormat(logFormat)
+		if err != nil {
+			return err
+		}
+		samples, err := m.samples()
+		if err != nil {
+			return fmt.Errorf("could not read archive (%v)", err)
+		}
+		err = writeLog(os.Stdout, logFormat, m, samples)
+		if err != nil {
+			return fmt.Errorf("could not write log (%v)", err)
+		}
+	default:
+		return fmt.Errorf("invalid archive command %q, want %v", strings.Join(args, " "), c.args)
+	}
+
+	return
+}
@@ -0,0 +1,64 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestLegacyArgs(t *testing.T) {
+	for _, c := range []struct {
+		args, x []string
+	}{
+		{[]string{"status", "-format", "json"}, []string{"status", "-format", "json"}},
+		{[]string{"-command", "status", "-format", "json"}, []string{"status", "-format", "json"}},
+		{[]string{"-format", "json", "-command=read"}, []string{"read", "-format", "json"}},
+		{[]string{"--command", "stop"}, []string{"stop"}},
+	} {
+		if x := legacyArgs(c.args); !reflect.DeepEqual(x, c.x) {
+			t.Errorf("legacyArgs(%q) = %q, want %q", c.args, x, c.x)
+		}
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	for name, c := range commands {
+		if c.run == nil && c.local == nil {
+			t.Errorf("%v has nothing to run", name)
+		}
+		if c.flags.Lookup("from") != nil && c.image == nil {
+			t.Errorf("%v takes -from but does not work on memory images", name)
+		}
+	}
+
+	// alarms are only enabled when given
+	start := commands["start"]
+	err := start.flags.Parse([]string{"-rate", "30s", "-high-alarm", "8"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := missionConfig(start.flags, startConfig, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.SampleRate != 30*time.Second || !config.HighAlarmEnabled || config.HighAlarm != 8 || config.LowAlarmEnabled {
+		t.Errorf("missionConfig() = %+v", config)
+	}
+}
@@ -19,127 +19,317 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"github.com/maxhille/go-ibutton/w1"
 	"os"
+	"sort"
+	"strings"
+	"time"
 )
 
-// parse arguments
-var command = flag.String("command", "help", "displays general help")
+// command is an ibutton subcommand with its own flags
+type command struct {
+	name  string
+	help  string
+	flags *flag.FlagSet
 
-func main() {
+	// args describes the arguments after the flags, empty for none
+	args string
+
+	// run runs the command against an opened iButton
+	run func(ctx context.Context, button *w1.Button) error
+
+	// image runs the command against the memory image given with -from,
+	// nil for commands which need a live iButton
+	image func(image *w1.Image) error
+
+	// local runs commands which do not work on a single iButton with the
+	// arguments after the flags
+	local func(args []string) error
+
+	// setup prepares the command after its flags are parsed
+	setup func() error
+}
+
+// commands by name
+var commands = map[string]*command{}
+
+// addCommand registers a command, its flags are added by the given function
+func addCommand(c *command, flags func(fs *flag.FlagSet)) {
+
+	c.flags = flag.NewFlagSet(c.name, flag.ExitOnError)
+	c.flags.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: ibutton %v [flags] %v\n\n%v\n", c.name, c.args, c.help)
+		fmt.Fprintf(os.Stderr, "\nflags:\n")
+		c.flags.PrintDefaults()
+	}
+	if flags != nil {
+		flags(c.flags)
+	}
+	commands[c.name] = c
+}
+
+// usage prints the general help
+func usage() {
+
+	fmt.Fprintf(os.Stderr, "usage: ibutton <command> [flags]\n\ncommands:\n")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-17v %v\n", name, strings.SplitN(commands[name].help, "\n", 2)[0])
+	}
+	fmt.Fprintf(os.Stderr, "\nrun \"ibutton help <command>\" for the flags of a command\n")
+}
+
+// options shared by the commands working on iButtons
+var (
+	device       string
+	all          bool
+	passwordFlag string
+	timezone     string
+	retries      int
+	retryBackoff time.Duration
+	timeout      time.Duration
+	from         string
+)
+
+// deviceFlags adds the iButton selection and access flags
+func deviceFlags(fs *flag.FlagSet) {
+
+	fs.StringVar(&device, "device", "", "ROM id of the iButton to use (e.g. 41-00000012ab34)")
+	fs.BoolVar(&all, "all", false, "run the command against every iButton on the bus")
+	fs.StringVar(&passwordFlag, "password", "", "password for password protected buttons")
+	fs.StringVar(&timezone, "timezone", "Local", "time zone the iButton clock runs in, Local, UTC or a zone name (e.g. Europe/Berlin)")
+	fs.IntVar(&retries, "retries", 3, "read attempts per memory page failing its CRC check, after the first")
+	fs.DurationVar(&retryBackoff, "retry-backoff", 50*time.Millisecond, "wait before reading a failed page again, doubled with every attempt")
+	fs.DurationVar(&timeout, "timeout", 0, "give up the command after the given time (0 for no limit)")
+}
+
+// imageFlags adds the device flags and the memory image source
+func imageFlags(fs *flag.FlagSet) {
+
+	deviceFlags(fs)
+	fs.StringVar(&from, "from", "", "decode the given memory image file instead of an iButton")
+}
 
-	flag.Parse()
+// runImage runs the command against the memory image given with -from
+func runImage(c *command, location *time.Location) (err error) {
 
-	switch *command {
-	case "status":
-		button := new(w1.Button)
-		err := button.Open()
-		defer button.Close()
+	if c.image == nil {
+		return fmt.Errorf("%v does not work on memory images", c.name)
+	}
+
+	file, err := os.Open(from)
+	if err != nil {
+		return fmt.Errorf("could not open memory image (%v)", err)
+	}
+	image, err := w1.ReadImage(file)
+	file.Close()
+	if err != nil {
+		return fmt.Errorf("could not read memory image (%v)", err)
+	}
+	image.Location = location
+
+	return c.image(image)
+}
+
+// runContext runs the command against the given iButton within the -timeout.
+// A transport blocked beyond the timeout is abandoned.
+func runContext(c *command, button *w1.Button) (err error) {
+
+	ctx, cancel := timeoutContext()
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.run(ctx, button)
+	}()
+
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("%v timed out (%v)", c.name, ctx.Err())
+	}
+
+	return
+}
+
+// timeoutContext is done after the -timeout
+func timeoutContext() (context.Context, context.CancelFunc) {
+
+	if timeout > 0 {
+		return context.WithTimeout(context.Background(), timeout)
+	}
+
+	return context.WithCancel(context.Background())
+}
+
+// openButtons opens the iButtons selected by the -device and -all flags
+func openButtons(password w1.Password) (buttons []*w1.Button, err error) {
+
+	// every iButton on the bus
+	if all {
+		transport := new(w1.SysfsTransport)
+		infos, err := w1.Enumerate(transport)
+		transport.Close()
 		if err != nil {
-			fmt.Printf("could not open iButton (%v)\n", err)
-			os.Exit(1)
+			return nil, err
 		}
-		status, err := button.Status()
-		if err != nil {
-			fmt.Printf("could not get iButton status (%v)\n", err)
-			os.Exit(1)
+		if len(infos) == 0 {
+			return nil, w1.ErrNoDevice
 		}
-		fmt.Printf("time:           %v\n", status.Time())
-		fmt.Printf("model:          %v\n", status.Name())
-		fmt.Printf("timestamp:      %v\n", status.MissionTimestamp())
-		fmt.Printf("count:          %v\n", status.SampleCount())
-		fmt.Printf("running:        %v\n", status.MissionInProgress())
-		fmt.Printf("memory cleared: %v\n", status.MemoryCleared())
-		fmt.Printf("resolution:     %v\n", func() string {
-			if status.HighResolution() {
-				return "0.0625°C"
+		for _, info := range infos {
+			button := new(w1.Button)
+			button.UsePassword(password)
+			err = button.OpenByID(info.ROM.String())
+			if err != nil {
+				return buttons, err
 			}
-			return "0.5°C"
-		}())
-		fmt.Printf("rate:           %v\n", status.SampleRate())
-	case "clear":
-		button := new(w1.Button)
-		err := button.Open()
-		defer button.Close()
-		if err != nil {
-			fmt.Printf("could not open button (%v)\n", err)
-			os.Exit(1)
-		}
-		err = button.ClearMemory()
-		if err != nil {
-			fmt.Printf("could not clear memory (%v)\n", err)
-			os.Exit(1)
-		}
-		fmt.Printf("Cleared Memory.\n")
-	case "start":
-		button := new(w1.Button)
-		err := button.Open()
-		defer button.Close()
-		if err != nil {
-			fmt.Printf("could not open button (%v)\n", err)
-			os.Exit(1)
-		}
-		err = button.WriteScratchpad()
-		if err != nil {
-			fmt.Printf("could not write scratchpad (%v)\n", err)
-			os.Exit(1)
+			buttons = append(buttons, button)
 		}
-		data, err := button.ReadScratchpad()
-		if err != nil {
-			fmt.Printf("could not read scratchpad (%v)\n", err)
+		return buttons, nil
+	}
 
-		}
-		// verify transfer status register
-		if data[2] != byte(0x1F) {
-			fmt.Printf("scratchpad verification failed (%v)\n", data)
-			os.Exit(1)
-		}
-		err = button.CopyScratchpad()
+	button := new(w1.Button)
+	button.UsePassword(password)
+	if device != "" {
+		err = button.OpenByID(device)
+	} else {
+		ctx, cancel := timeoutContext()
+		err = button.OpenContext(ctx)
+		cancel()
+	}
+	if err != nil {
+		return
+	}
+
+	return []*w1.Button{button}, nil
+}
+
+// runButtons opens the selected iButtons and runs the command against
+// each, reporting failures at the end
+func runButtons(c *command) (err error) {
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("invalid time zone (%v)", err)
+	}
+
+	// decode a memory image instead of a live iButton
+	if from != "" {
+		return runImage(c, location)
+	}
+
+	var password w1.Password
+	if passwordFlag != "" {
+		password, err = w1.NewPassword(passwordFlag)
 		if err != nil {
-			fmt.Printf("could not copy scratchpad (%v)\n", err)
-			os.Exit(1)
+			return fmt.Errorf("invalid password (%v)", err)
 		}
-		err = button.StartMission()
-		if err != nil {
-			fmt.Printf("could not start mission (%v)\n", err)
-			os.Exit(1)
+	}
+
+	buttons, err := openButtons(password)
+	defer func() {
+		for _, button := range buttons {
+			button.Close()
 		}
-		fmt.Printf("Started mission.\n")
-	case "read":
-		button := new(w1.Button)
-		err := button.Open()
-		defer button.Close()
-		if err != nil {
-			fmt.Printf("could not open button (%v)\n", err)
-			os.Exit(1)
+	}()
+	if err != nil {
+		return fmt.Errorf("could not open iButton (%v)", err)
+	}
+
+	failed := 0
+	for _, button := range buttons {
+		button.SetLocation(location)
+		button.SetRetries(retries, retryBackoff)
+		// keep stdout machine readable, the output formats carry the ROM id
+		if all {
+			fmt.Fprintf(os.Stderr, "%v:\n", button.ROM())
 		}
-		samples, err := button.ReadLog()
-		if err != nil {
-			fmt.Printf("could not read log (%v)\n", err)
-			os.Exit(1)
+		err = runContext(c, button)
+		if button.RetriedPages() > 0 {
+			fmt.Fprintf(os.Stderr, "retried %v page reads after CRC errors\n", button.RetriedPages())
 		}
-		for _, sample := range samples {
-			fmt.Printf("%v\t%3.3f°C\n", sample.Time, sample.Temp)
+		if err != nil && len(buttons) > 1 {
+			fmt.Fprintf(os.Stderr, "%v: %v\n", button.ROM(), err)
+			failed++
 		}
-	case "stop":
-		button := new(w1.Button)
-		err := button.Open()
-		defer button.Close()
-		if err != nil {
-			fmt.Printf("could not open button (%v)\n", err)
-			os.Exit(1)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%v failed for %v of %v iButtons", c.name, failed, len(buttons))
+	}
+
+	return
+}
+
+// legacyArgs rewrites the old "-command name" form to "name"
+func legacyArgs(args []string) []string {
+
+	for i, arg := range args {
+		switch {
+		case (arg == "-command" || arg == "--command") && i+1 < len(args):
+			rest := append(append([]string{}, args[:i]...), args[i+2:]...)
+			return append([]string{args[i+1]}, rest...)
+		case strings.HasPrefix(arg, "-command=") || strings.HasPrefix(arg, "--command="):
+			rest := append(append([]string{}, args[:i]...), args[i+1:]...)
+			return append([]string{arg[strings.Index(arg, "=")+1:]}, rest...)
 		}
-		err = button.StopMission()
-		if err != nil {
-			fmt.Printf("could not stop mission (%v)\n", err)
-			os.Exit(1)
+	}
+
+	return args
+}
+
+func main() {
+
+	args := legacyArgs(os.Args[1:])
+	if len(args) == 0 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		if len(args) > 1 && commands[args[1]] != nil {
+			commands[args[1]].flags.Usage()
+			return
 		}
-		fmt.Printf("Stopped mission.\n")
-	case "help":
-		flag.Usage()
+		usage()
+		return
+	}
+
+	c := commands[name]
+	if c == nil {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+	c.flags.Parse(args[1:])
+	if c.flags.NArg() > 0 && c.args == "" {
+		fmt.Fprintf(os.Stderr, "unexpected arguments %q\n\n", c.flags.Args())
+		c.flags.Usage()
 		os.Exit(2)
 	}
 
+	var err error
+	if c.setup != nil {
+		err = c.setup()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			os.Exit(2)
+		}
+	}
+	if c.local != nil {
+		err = c.local(c.flags.Args())
+	} else {
+		err = runButtons(c)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%v\n", err)
+		os.Exit(1)
+	}
 }
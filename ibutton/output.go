@@ -0,0 +1,298 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/maxhille/go-ibutton/w1"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mission describes a logged mission, of a live iButton status or the archive
+type mission interface {
+	ROM() w1.ROM
+	Name() string
+	MissionTimestamp() time.Time
+	SampleRate() time.Duration
+	Drift() time.Duration
+	TemperatureLogging() bool
+	HumidityLogging() bool
+}
+
+// logHeader describes a mission log
+type logHeader struct {
+	ROM          string            `json:"rom"`
+	Model        string            `json:"model"`
+	MissionStart string            `json:"mission_start"`
+	SampleRate   float64           `json:"sample_rate_seconds"`
+	ClockDrift   float64           `json:"clock_drift_seconds"`
+	Units        map[string]string `json:"units"`
+}
+
+// logSample is a mission log sample with the mission's channels
+type logSample struct {
+	Time        string      `json:"time"`
+	Temperature json.Number `json:"temperature,omitempty"`
+	Humidity    json.Number `json:"humidity,omitempty"`
+}
+
+// logFormats are the formats writeLog supports
+var logFormats = []string{"text", "csv", "tsv", "json", "ndjson"}
+
+// statusFormats are the formats writeStatus supports
+var statusFormats = []string{"text", "json", "yaml"}
+
+// checkLogFormat fails for formats writeLog does not support
+func checkLogFormat(format string) error {
+
+	return checkFormat(format, logFormats)
+}
+
+// checkFormat fails if the given format is not one of the given formats
+func checkFormat(format string, formats []string) error {
+
+	for _, f := range formats {
+		if f == format {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown format %q, want one of %v", format, formats)
+}
+
+// writeStatus writes the given button status in the given format
+func writeStatus(w io.Writer, format string, status *w1.Status) (err error) {
+
+	err = checkFormat(format, statusFormats)
+	if err != nil {
+		return
+	}
+
+	switch format {
+	case "text":
+		fmt.Fprintf(w, "time:           %v\n", status.Time())
+		fmt.Fprintf(w, "drift:          %v\n", status.Drift())
+		fmt.Fprintf(w, "model:          %v\n", status.Name())
+		fmt.Fprintf(w, "rom:            %v\n", status.ROM())
+		fmt.Fprintf(w, "range:          %v\n", func() string {
+			min, max := status.TemperatureRange()
+			return fmt.Sprintf("%3.1f°C to %3.1f°C", min, max)
+		}())
+		fmt.Fprintf(w, "timestamp:      %v\n", func() interface{} {
+			if status.MissionTimestamp().IsZero() {
+				return "none"
+			}
+			return status.MissionTimestamp()
+		}())
+		fmt.Fprintf(w, "count:          %v\n", status.SampleCount())
+		fmt.Fprintf(w, "running:        %v\n", func() string {
+			if status.WaitingToStart() {
+				return fmt.Sprintf("waiting to start (%v left)", status.StartDelay())
+			}
+			if status.WaitingForAlarm() {
+				return "waiting for temperature alarm"
+			}
+			return fmt.Sprint(status.MissionInProgress())
+		}())
+		fmt.Fprintf(w, "memory cleared: %v\n", status.MemoryCleared())
+		fmt.Fprintf(w, "rollover:       %v\n", func() string {
+			if status.RolledOver() {
+				return "true (oldest samples overwritten)"
+			}
+			return fmt.Sprint(status.Rollover())
+		}())
+		fmt.Fprintf(w, "passwords:      %v\n", status.PasswordsEnabled())
+		fmt.Fprintf(w, "logging:        %v\n", func() string {
+			var logged []string
+			if status.TemperatureLogging() {
+				logged = append(logged, "temperature")
+			}
+			if status.HumidityLogging() {
+				logged = append(logged, "humidity")
+			}
+			return strings.Join(logged, ", ")
+		}())
+		fmt.Fprintf(w, "resolution:     %v\n", func() string {
+			if status.HighResolution() {
+				return "0.0625°C"
+			}
+			return "0.5°C"
+		}())
+		fmt.Fprintf(w, "rate:           %v\n", status.SampleRate())
+		fmt.Fprintf(w, "low alarm:      %v\n", alarm(status.LowAlarm(), status.LowAlarmEnabled()))
+		fmt.Fprintf(w, "high alarm:     %v\n", alarm(status.HighAlarm(), status.HighAlarmEnabled()))
+		fmt.Fprintf(w, "alarms:         %v\n", status.Alarms())
+	case "json":
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(status)
+	case "yaml":
+		err = writeYAML(w, status)
+	}
+
+	return
+}
+
+// alarm formats an alarm threshold
+func alarm(temp w1.Temperature, enabled bool) string {
+
+	if !enabled {
+		return "disabled"
+	}
+
+	return fmt.Sprintf("%3.1f°C", temp)
+}
+
+// newLogHeader describes the given mission
+func newLogHeader(status mission) logHeader {
+
+	header := logHeader{
+		ROM:          status.ROM().String(),
+		Model:        status.Name(),
+		MissionStart: status.MissionTimestamp().Format(time.RFC3339Nano),
+		SampleRate:   status.SampleRate().Seconds(),
+		ClockDrift:   status.Drift().Seconds(),
+		Units:        map[string]string{},
+	}
+	if status.TemperatureLogging() {
+		header.Units["temperature"] = "°C"
+	}
+	if status.HumidityLogging() {
+		header.Units["humidity"] = "%RH"
+	}
+
+	return header
+}
+
+// newLogSample converts the given sample, leaving out channels the mission does not log
+func newLogSample(status mission, sample w1.Sample) logSample {
+
+	out := logSample{Time: sample.Time.Format(time.RFC3339Nano)}
+	if status.TemperatureLogging() {
+		out.Temperature = json.Number(formatFloat(float32(sample.Temp)))
+	}
+	if status.HumidityLogging() {
+		out.Humidity = json.Number(formatFloat(float32(sample.Humidity)))
+	}
+
+	return out
+}
+
+// formatFloat formats a sample value with the shortest exact representation
+func formatFloat(value float32) string {
+
+	return strconv.FormatFloat(float64(value), 'f', -1, 32)
+}
+
+// writeLog writes the given mission log in the given format
+func writeLog(w io.Writer, format string, status mission, samples []w1.Sample) (err error) {
+
+	err = checkLogFormat(format)
+	if err != nil {
+		return
+	}
+
+	header := newLogHeader(status)
+
+	switch format {
+	case "text":
+		// with -all the lines of several iButtons are told apart by ROM id
+		for _, sample := range samples {
+			if all {
+				fmt.Fprintf(w, "%v\t", header.ROM)
+			}
+			switch {
+			case status.TemperatureLogging() && status.HumidityLogging():
+				fmt.Fprintf(w, "%v\t%3.3f°C\t%3.1f%%RH\n", sample.Time, sample.Temp, sample.Humidity)
+			case status.HumidityLogging():
+				fmt.Fprintf(w, "%v\t%3.1f%%RH\n", sample.Time, sample.Humidity)
+			default:
+				fmt.Fprintf(w, "%v\t%3.3f°C\n", sample.Time, sample.Temp)
+			}
+		}
+	case "csv", "tsv":
+		err = writeTable(w, format, header, status, samples)
+	case "json":
+		out := struct {
+			logHeader
+			Samples []logSample `json:"samples"`
+		}{header, make([]logSample, len(samples))}
+		for i, sample := range samples {
+			out.Samples[i] = newLogSample(status, sample)
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(out)
+	case "ndjson":
+		encoder := json.NewEncoder(w)
+		err = encoder.Encode(header)
+		for _, sample := range samples {
+			if err != nil {
+				break
+			}
+			err = encoder.Encode(newLogSample(status, sample))
+		}
+	}
+
+	return
+}
+
+// writeTable writes the mission log as comma or tab separated values,
+// preceded by the header as comment lines
+func writeTable(w io.Writer, format string, header logHeader, status mission, samples []w1.Sample) (err error) {
+
+	fmt.Fprintf(w, "# rom: %v\n", header.ROM)
+	fmt.Fprintf(w, "# model: %v\n", header.Model)
+	fmt.Fprintf(w, "# mission start: %v\n", header.MissionStart)
+	fmt.Fprintf(w, "# sample rate: %vs\n", header.SampleRate)
+	fmt.Fprintf(w, "# clock drift: %vs\n", header.ClockDrift)
+
+	writer := csv.NewWriter(w)
+	if format == "tsv" {
+		writer.Comma = '\t'
+	}
+
+	columns := []string{"time"}
+	if status.TemperatureLogging() {
+		columns = append(columns, "temperature [°C]")
+	}
+	if status.HumidityLogging() {
+		columns = append(columns, "humidity [%RH]")
+	}
+	writer.Write(columns)
+
+	for _, sample := range samples {
+		out := newLogSample(status, sample)
+		record := []string{out.Time}
+		if status.TemperatureLogging() {
+			record = append(record, out.Temperature.String())
+		}
+		if status.HumidityLogging() {
+			record = append(record, out.Humidity.String())
+		}
+		writer.Write(record)
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
@@ -0,0 +1,155 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/maxhille/go-ibutton/emulator"
+	"github.com/maxhille/go-ibutton/w1"
+	"strings"
+	"testing"
+	"time"
+)
+
+// emulatedMission returns the status and log of an emulated DS1923 mission
+func emulatedMission(t *testing.T) (*w1.Status, []w1.Sample) {
+
+	return download(t, emulatedButton(t))
+}
+
+// emulatedButton returns an emulated DS1923 two minutes into a mission
+func emulatedButton(t *testing.T) *w1.Button {
+	now := time.Date(2013, 4, 1, 15, 30, 0, 0, time.UTC)
+	device := emulator.NewDevice(w1.DS1923, 0x12ab34)
+	device.Now = func() time.Time { return now }
+	device.Temperature = func(time.Time) float64 { return 21.5 }
+	device.Humidity = func(time.Time) float64 { return 40 }
+	button := w1.NewButton(emulator.NewBus(device), device.ROM())
+
+	config := w1.MissionConfig{SampleRate: time.Minute, LogTemperature: true, LogHumidity: true,
+		HighResolution: true, HumidityHighResolution: true}
+	if err := button.StartMission(config); err != nil {
+		t.Fatalf("StartMission() = %v", err)
+	}
+	now = now.Add(2 * time.Minute)
+
+	return button
+}
+
+// download reads status and log of the given button
+func download(t *testing.T, button *w1.Button) (*w1.Status, []w1.Sample) {
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	samples, err := button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+
+	return status, samples
+}
+
+func TestWriteLogText(t *testing.T) {
+	status, samples := emulatedMission(t)
+	var out bytes.Buffer
+	if err := writeLog(&out, "text", status, samples); err != nil {
+		t.Fatalf("writeLog() = %v", err)
+	}
+	if lines := strings.Split(strings.TrimSpace(out.String()), "\n"); len(lines) != 3 || strings.HasPrefix(lines[0], "41-") {
+		t.Errorf("writeLog() = %q, want 3 lines without ROM id", lines)
+	}
+
+	// -all lines start with the ROM id
+	all = true
+	defer func() { all = false }()
+	out.Reset()
+	if err := writeLog(&out, "text", status, samples); err != nil {
+		t.Fatalf("writeLog() = %v", err)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		if !strings.HasPrefix(line, "41-00000012ab34\t") {
+			t.Errorf("writeLog() with -all = %q, want ROM id column", line)
+		}
+	}
+}
+
+func TestWriteLogCSV(t *testing.T) {
+	status, samples := emulatedMission(t)
+	var out bytes.Buffer
+	if err := writeLog(&out, "csv", status, samples); err != nil {
+		t.Fatalf("writeLog() = %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 9 {
+		t.Fatalf("writeLog() wrote %v lines, want 9:\n%v", len(lines), out.String())
+	}
+	if lines[0] != "# rom: 41-00000012ab34" || lines[1] != "# model: DS1923" || lines[3] != "# sample rate: 60s" ||
+		!strings.HasPrefix(lines[4], "# clock drift: ") {
+		t.Errorf("writeLog() header = %q", lines[:5])
+	}
+	if x := lines[5]; x != "time,temperature [°C],humidity [%RH]" {
+		t.Errorf("writeLog() columns = %q", x)
+	}
+	fields := strings.Split(lines[6], ",")
+	if _, err := time.Parse(time.RFC3339Nano, fields[0]); err != nil || fields[1] != "21.5" {
+		t.Errorf("writeLog() sample = %q", lines[6])
+	}
+}
+
+func TestWriteLogJSON(t *testing.T) {
+	status, samples := emulatedMission(t)
+	var out bytes.Buffer
+	if err := writeLog(&out, "json", status, samples); err != nil {
+		t.Fatalf("writeLog() = %v", err)
+	}
+
+	var log struct {
+		logHeader
+		Samples []struct {
+			Time        time.Time
+			Temperature float64
+			Humidity    float64
+		}
+	}
+	if err := json.Unmarshal(out.Bytes(), &log); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if log.ROM != status.ROM().String() || log.Model != "DS1923" || log.SampleRate != 60 || log.Units["humidity"] != "%RH" {
+		t.Errorf("writeLog() header = %+v", log.logHeader)
+	}
+	if len(log.Samples) != 3 || log.Samples[0].Temperature != 21.5 || log.Samples[2].Time.Sub(log.Samples[0].Time) != 2*time.Minute {
+		t.Errorf("writeLog() samples = %+v", log.Samples)
+	}
+}
+
+func TestWriteLogNDJSON(t *testing.T) {
+	status, samples := emulatedMission(t)
+	var out bytes.Buffer
+	if err := writeLog(&out, "ndjson", status, samples); err != nil {
+		t.Fatalf("writeLog() = %v", err)
+	}
+	if x := strings.Count(out.String(), "\n"); x != 4 {
+		t.Errorf("writeLog() wrote %v lines, want 4", x)
+	}
+	if err := writeLog(&out, "xml", status, samples); err == nil {
+		t.Errorf("writeLog(\"xml\") = nil, want error")
+	}
+}
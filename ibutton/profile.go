@@ -0,0 +1,159 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"github.com/maxhille/go-ibutton/w1"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// options of the start command selecting a mission profile
+var (
+	profileName string
+	profileFile string
+)
+
+// profileFlags adds the mission profile flags
+func profileFlags(fs *flag.FlagSet) {
+
+	fs.StringVar(&profileName, "profile", "", "start the mission with the settings of the named profile")
+	fs.StringVar(&profileFile, "profiles", defaultProfileFile(), "mission profile file")
+}
+
+// defaultProfileFile is ibutton/profiles.json in the user's config directory
+func defaultProfileFile() string {
+
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "profiles.json"
+	}
+
+	return filepath.Join(dir, "ibutton", "profiles.json")
+}
+
+// profile is a named mission with the passwords to protect it, read from
+// a JSON object of mission settings by start flag name (e.g. "rate": "5m",
+// "high-alarm": 8, "rollover": true) and "read-password", "full-password"
+type profile struct {
+	w1.MissionConfig
+	ReadPassword string
+	FullPassword string
+}
+
+// the profile selected with -profile, nil for none
+var startProfile *profile
+
+// readProfiles reads the profiles of the given file, a JSON object of
+// profiles by name. Start times are in the given location.
+func readProfiles(path string, location *time.Location) (profiles map[string]*profile, err error) {
+
+	file, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	var in map[string]map[string]interface{}
+	decoder := json.NewDecoder(file)
+	decoder.UseNumber()
+	err = decoder.Decode(&in)
+	if err != nil {
+		return nil, fmt.Errorf("invalid profile file %v (%v)", path, err)
+	}
+
+	profiles = make(map[string]*profile, len(in))
+	for name, settings := range in {
+		profiles[name], err = newProfile(settings, location)
+		if err != nil {
+			return nil, fmt.Errorf("profile %v: %v", name, err)
+		}
+	}
+
+	return
+}
+
+// newProfile builds a profile from the given settings, starting from the
+// start command's defaults. Anything but mission settings and passwords
+// is rejected.
+func newProfile(settings map[string]interface{}, location *time.Location) (p *profile, err error) {
+
+	p = &profile{MissionConfig: startConfig}
+
+	names := make([]string, 0, len(settings))
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		var value string
+		switch v := settings[name].(type) {
+		case string:
+			value = v
+		case json.Number, bool:
+			value = fmt.Sprint(v)
+		default:
+			return nil, fmt.Errorf("setting %q is not a string, number or boolean", name)
+		}
+
+		switch {
+		case name == "read-password":
+			p.ReadPassword = value
+		case name == "full-password":
+			p.FullPassword = value
+		case isMissionSetting(name):
+			err = setMissionSetting(&p.MissionConfig, name, value, location)
+			if err != nil {
+				return
+			}
+		default:
+			return nil, fmt.Errorf("%q is not a mission setting", name)
+		}
+	}
+
+	return
+}
+
+// applyProfile loads the profile selected with -profile
+func applyProfile() (err error) {
+
+	if profileName == "" {
+		return
+	}
+
+	location, err := time.LoadLocation(timezone)
+	if err != nil {
+		return fmt.Errorf("invalid time zone (%v)", err)
+	}
+	profiles, err := readProfiles(profileFile, location)
+	if err != nil {
+		return fmt.Errorf("could not read profiles (%v)", err)
+	}
+	startProfile = profiles[profileName]
+	if startProfile == nil {
+		return fmt.Errorf("no profile %q in %v", profileName, profileFile)
+	}
+
+	return
+}
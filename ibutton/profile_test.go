@@ -0,0 +1,88 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testProfiles = `{
+	"fridge-study": {
+		"rate": "5m",
+		"resolution": "low",
+		"high-alarm": 8,
+		"rollover": true,
+		"full-password": "owner"
+	}
+}`
+
+func TestProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "profiles.json")
+	err := os.WriteFile(path, []byte(testProfiles), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := readProfiles(path, time.UTC)
+	if err != nil {
+		t.Fatalf("readProfiles() = %v", err)
+	}
+	p := profiles["fridge-study"]
+	if p == nil {
+		t.Fatalf("readProfiles() = %v, want fridge-study", profiles)
+	}
+	if p.SampleRate != 5*time.Minute || p.HighResolution || !p.Rollover || !p.LogTemperature ||
+		!p.HighAlarmEnabled || p.HighAlarm != 8 || p.LowAlarmEnabled || p.FullPassword != "owner" {
+		t.Errorf("profile = %+v", p)
+	}
+
+	// the command line wins over the profile
+	fs := flag.NewFlagSet("start", flag.ContinueOnError)
+	startFlags(fs)
+	err = fs.Parse([]string{"-rate", "1m"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	config, err := missionConfig(fs, p.MissionConfig, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.SampleRate != time.Minute || config.HighResolution || !config.Rollover || !config.HighAlarmEnabled {
+		t.Errorf("missionConfig() = %+v", config)
+	}
+}
+
+func TestProfileSettings(t *testing.T) {
+	for _, settings := range []map[string]interface{}{
+		{"all": true},
+		{"device": "41-00000012ab34"},
+		{"timeout": "1m"},
+		{"password": "reader"},
+		{"rate": "soon"},
+		{"channels": "pressure"},
+		{"high-alarm": []interface{}{8}},
+	} {
+		if _, err := newProfile(settings, time.UTC); err == nil {
+			t.Errorf("newProfile(%v) succeeded", settings)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// PROGRESS_WIDTH is the width of the progress bar in characters
+const PROGRESS_WIDTH = 30
+
+// progressBar draws the log download progress on one terminal line
+type progressBar struct {
+	w     io.Writer
+	now   func() time.Time
+	start time.Time
+}
+
+// newProgressBar returns a progress bar drawing to the given writer
+func newProgressBar(w io.Writer, now func() time.Time) *progressBar {
+
+	return &progressBar{w: w, now: now, start: now()}
+}
+
+// update redraws the bar for the given count of pages read, ending the line
+// once all pages are read
+func (p *progressBar) update(read, total int) {
+
+	if total <= 0 {
+		return
+	}
+
+	filled := PROGRESS_WIDTH * read / total
+	bar := strings.Repeat("#", filled) + strings.Repeat(".", PROGRESS_WIDTH-filled)
+	fmt.Fprintf(p.w, "\r[%v] %v/%v pages", bar, read, total)
+
+	// throughput and remaining time from the average page rate
+	elapsed := p.now().Sub(p.start)
+	if elapsed > 0 {
+		rate := float64(read) / elapsed.Seconds()
+		fmt.Fprintf(p.w, "  %.0f B/s", rate*32)
+		if rate > 0 && read < total {
+			eta := time.Duration(float64(total-read) / rate * float64(time.Second))
+			fmt.Fprintf(p.w, "  ETA %v", eta.Round(time.Second))
+		}
+	}
+
+	// clear the rest of a longer previous line
+	fmt.Fprint(p.w, "\033[K")
+	if read >= total {
+		fmt.Fprintln(p.w)
+	}
+}
+
+// isTerminal true if the given file is a terminal
+func isTerminal(file *os.File) bool {
+
+	info, err := file.Stat()
+	if err != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
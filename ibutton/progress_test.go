@@ -0,0 +1,47 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressBar(t *testing.T) {
+	now := time.Date(2013, 4, 1, 15, 30, 0, 0, time.UTC)
+	var out bytes.Buffer
+	bar := newProgressBar(&out, func() time.Time { return now })
+
+	now = now.Add(10 * time.Second)
+	bar.update(64, 256)
+	if x := out.String(); !strings.Contains(x, "[#######.......................] 64/256 pages  205 B/s  ETA 30s") {
+		t.Errorf("update(64, 256) wrote %q", x)
+	}
+	if strings.HasSuffix(out.String(), "\n") {
+		t.Errorf("update(64, 256) ended the line")
+	}
+
+	out.Reset()
+	now = now.Add(30 * time.Second)
+	bar.update(256, 256)
+	if x := out.String(); !strings.Contains(x, "256/256 pages") || strings.Contains(x, "ETA") || !strings.HasSuffix(x, "\n") {
+		t.Errorf("update(256, 256) wrote %q", x)
+	}
+}
@@ -0,0 +1,102 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+)
+
+// writeYAML writes the JSON encoding of the given value as a YAML block,
+// keeping the order of object keys. JSON strings are valid YAML scalars.
+func writeYAML(w io.Writer, v interface{}) (err error) {
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+
+	writer := bufio.NewWriter(w)
+	err = writeYAMLValue(writer, decoder, "", "")
+	if err != nil {
+		return
+	}
+
+	return writer.Flush()
+}
+
+// writeYAMLValue writes the next JSON value. The prefix ("key: " or "- ")
+// is written on the value's line, nested values are indented with indent.
+func writeYAMLValue(w *bufio.Writer, decoder *json.Decoder, prefix string, indent string) (err error) {
+
+	token, err := decoder.Token()
+	if err != nil {
+		return
+	}
+
+	switch token {
+	case json.Delim('{'), json.Delim('['):
+		object := token == json.Delim('{')
+
+		// empty containers stay on the line
+		if !decoder.More() {
+			_, err = decoder.Token()
+			if object {
+				w.WriteString(prefix + "{}\n")
+			} else {
+				w.WriteString(prefix + "[]\n")
+			}
+			return
+		}
+
+		if prefix != "" {
+			w.WriteString(strings.TrimRight(prefix, " ") + "\n")
+		}
+		for decoder.More() {
+			itemPrefix := indent + "- "
+			if object {
+				key, err := decoder.Token()
+				if err != nil {
+					return err
+				}
+				itemPrefix = indent + key.(string) + ": "
+			}
+			err = writeYAMLValue(w, decoder, itemPrefix, indent+"  ")
+			if err != nil {
+				return
+			}
+		}
+		_, err = decoder.Token()
+	case nil:
+		w.WriteString(prefix + "null\n")
+	default:
+		scalar, err := json.Marshal(token)
+		if err != nil {
+			return err
+		}
+		w.WriteString(prefix + string(scalar) + "\n")
+	}
+
+	return
+}
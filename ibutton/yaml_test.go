@@ -0,0 +1,54 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestWriteYAML(t *testing.T) {
+	v := struct {
+		Name   string                 `json:"name"`
+		Count  int                    `json:"count"`
+		Rate   float64                `json:"rate"`
+		Alarm  map[string]interface{} `json:"alarm"`
+		Flags  []string               `json:"flags"`
+		Empty  []string               `json:"empty"`
+		Absent *int                   `json:"absent"`
+	}{"41-00000012ab34", 3, 0.5, map[string]interface{}{"enabled": true}, []string{"a: b"}, []string{}, nil}
+
+	var out bytes.Buffer
+	if err := writeYAML(&out, v); err != nil {
+		t.Fatalf("writeYAML() = %v", err)
+	}
+
+	want := `name: "41-00000012ab34"
+count: 3
+rate: 0.5
+alarm:
+  enabled: true
+flags:
+  - "a: b"
+empty: []
+absent: null
+`
+	if x := out.String(); x != want {
+		t.Errorf("writeYAML() =\n%v\nwant\n%v", x, want)
+	}
+}
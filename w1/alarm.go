@@ -0,0 +1,102 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"strings"
+)
+
+// Alarm represents the flags of the alarm status register (0x0214)
+type Alarm byte
+
+// alarm status flags
+const (
+	LowTemperatureAlarm  Alarm = 0x01 << 0
+	HighTemperatureAlarm Alarm = 0x01 << 1
+	LowHumidityAlarm     Alarm = 0x01 << 2
+	HighHumidityAlarm    Alarm = 0x01 << 3
+	BatteryOnResetAlarm  Alarm = 0x01 << 4
+)
+
+// alarm names
+var alarmNames = []struct {
+	alarm Alarm
+	name  string
+}{
+	{LowTemperatureAlarm, "low temperature"},
+	{HighTemperatureAlarm, "high temperature"},
+	{LowHumidityAlarm, "low humidity"},
+	{HighHumidityAlarm, "high humidity"},
+	{BatteryOnResetAlarm, "battery on reset"},
+}
+
+// String lists the names of the set alarm flags
+func (a Alarm) String() string {
+
+	var names []string
+	for _, alarm := range alarmNames {
+		if a&alarm.alarm != 0 {
+			names = append(names, alarm.name)
+		}
+	}
+
+	if len(names) == 0 {
+		return "none"
+	}
+
+	return strings.Join(names, ", ")
+}
+
+// SetLowAlarm programs the low temperature alarm threshold and enable
+func (b *Button) SetLowAlarm(temp Temperature, enabled bool) (err error) {
+
+	return b.setAlarm(0x08, 0x01<<0, temp, enabled)
+}
+
+// SetHighAlarm programs the high temperature alarm threshold and enable
+func (b *Button) SetHighAlarm(temp Temperature, enabled bool) (err error) {
+
+	return b.setAlarm(0x09, 0x01<<1, temp, enabled)
+}
+
+// setAlarm programs the temperature alarm threshold at the given status
+// offset and the given temperature alarm enable bit
+func (b *Button) setAlarm(offset int, bit byte, temp Temperature, enabled bool) (err error) {
+
+	status, err := b.idleStatus()
+	if err != nil {
+		return
+	}
+
+	threshold, err := encodeThreshold(status.DeviceId(), temp)
+	if err != nil {
+		return
+	}
+
+	// rewrite thresholds through temperature alarm enable (0x0208-0x0210)
+	data := make([]byte, 9)
+	copy(data, status.bytes[0x08:0x11])
+	data[offset-0x08] = threshold
+	if enabled {
+		data[8] |= bit
+	} else {
+		data[8] &^= bit
+	}
+
+	return b.writeRegisters(0x0208, data)
+}
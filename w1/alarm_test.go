@@ -0,0 +1,165 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"github.com/maxhille/go-ibutton/w1"
+	"testing"
+	"time"
+)
+
+func TestAlarmString(t *testing.T) {
+	tests := []struct {
+		alarm w1.Alarm
+		out   string
+	}{
+		{0, "none"},
+		{w1.HighTemperatureAlarm, "high temperature"},
+		{w1.LowTemperatureAlarm | w1.BatteryOnResetAlarm, "low temperature, battery on reset"},
+	}
+	for _, test := range tests {
+		if x := test.alarm.String(); x != test.out {
+			t.Errorf("Alarm(%#x).String() = %q, want %q", byte(test.alarm), x, test.out)
+		}
+	}
+}
+
+func TestSetAlarms(t *testing.T) {
+	button, _, _ := newButton(w1.DS1922T)
+	if err := button.SetLowAlarm(2.5, true); err != nil {
+		t.Fatalf("SetLowAlarm() = %v", err)
+	}
+	if err := button.SetHighAlarm(110, false); err != nil {
+		t.Fatalf("SetHighAlarm() = %v", err)
+	}
+	if err := button.SetHighAlarm(130, true); err == nil {
+		t.Errorf("SetHighAlarm(130°C) = nil, want out of range error")
+	}
+
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if x := status.LowAlarm(); x != 2.5 {
+		t.Errorf("LowAlarm() = %v, want 2.5", x)
+	}
+	if !status.LowAlarmEnabled() {
+		t.Errorf("LowAlarmEnabled() = false, want true")
+	}
+	if x := status.HighAlarm(); x != 110 {
+		t.Errorf("HighAlarm() = %v, want 110", x)
+	}
+	if status.HighAlarmEnabled() {
+		t.Errorf("HighAlarmEnabled() = true, want false")
+	}
+}
+
+func TestMissionAlarms(t *testing.T) {
+	button, device, c := newButton(w1.DS1922L)
+	start := c.now
+	device.Temperature = func(t time.Time) float64 {
+		if t.Sub(start) == 20*time.Minute {
+			return 31
+		}
+		return 20
+	}
+
+	config := w1.DefaultMissionConfig
+	config.LowAlarm, config.LowAlarmEnabled = 5, true
+	config.HighAlarm, config.HighAlarmEnabled = 30, true
+	startMissionConfig(t, button, config)
+
+	c.now = c.now.Add(10 * time.Minute)
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if x := status.Alarms(); x != 0 {
+		t.Errorf("Alarms() = %v, want none", x)
+	}
+
+	c.now = c.now.Add(20 * time.Minute)
+	status, err = button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if x := status.Alarms(); x != w1.HighTemperatureAlarm {
+		t.Errorf("Alarms() = %v, want high temperature", x)
+	}
+	if err := button.SetLowAlarm(0, false); err == nil {
+		t.Errorf("SetLowAlarm() during mission = nil, want error")
+	}
+}
+
+func TestStartUponAlarm(t *testing.T) {
+	button, device, c := newButton(w1.DS1922L)
+	start := c.now
+	device.Temperature = func(t time.Time) float64 {
+		if t.Sub(start) > 30*time.Minute {
+			return 30
+		}
+		return 20
+	}
+	config := w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute,
+		HighAlarm: 25, HighAlarmEnabled: true, StartUponAlarm: true}
+	startMissionConfig(t, button, config)
+
+	// no samples are logged before the alarm
+	c.now = start.Add(10 * time.Minute)
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if !status.StartUponAlarm() || !status.WaitingForAlarm() || !status.MissionInProgress() {
+		t.Errorf("StartUponAlarm(), WaitingForAlarm(), MissionInProgress() = %v, %v, %v, want true, true, true",
+			status.StartUponAlarm(), status.WaitingForAlarm(), status.MissionInProgress())
+	}
+	if x := status.MissionTimestamp(); !x.IsZero() {
+		t.Errorf("MissionTimestamp() = %v, want zero time", x)
+	}
+	samples, err := button.ReadLog()
+	if err != nil || len(samples) != 0 {
+		t.Errorf("ReadLog() = %v samples, %v, want 0 samples", len(samples), err)
+	}
+
+	// logging starts with the first sample over the threshold
+	c.now = start.Add(40 * time.Minute)
+	status, err = button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if status.WaitingForAlarm() {
+		t.Errorf("WaitingForAlarm() = true after the alarm")
+	}
+	if x, want := status.MissionTimestamp(), start.Add(31*time.Minute); !x.Equal(want) {
+		t.Errorf("MissionTimestamp() = %v, want %v", x, want)
+	}
+	samples, err = button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+	if len(samples) != 10 {
+		t.Fatalf("len(ReadLog()) = %v, want 10", len(samples))
+	}
+	if samples[0].Temp != 30 || !samples[0].Time.Equal(start.Add(31*time.Minute)) {
+		t.Errorf("ReadLog()[0] = %+v, want 30°C at %v", samples[0], start.Add(31*time.Minute))
+	}
+	if status.Alarms()&w1.HighTemperatureAlarm == 0 {
+		t.Errorf("Alarms() = %v, want high temperature", status.Alarms())
+	}
+}
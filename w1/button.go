@@ -19,11 +19,12 @@
 package w1
 
 import (
+	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"github.com/maxhille/go-ibutton/crc16"
 	"os"
-	"strings"
-	"strconv"
 	"time"
 )
 
@@ -50,32 +51,114 @@ const (
 	DS1922E          = 0x80
 )
 
-// device specific data
+// device specific data: name, temperature encoding offset, support,
+// calibration reference point Tr1 and operating temperature range. The
+// offset is the temperature of the raw value 0 as given by each data sheet's
+// temperature conversion formula (e.g. DS1922E: T = TRH/2 + 14 + TRL/512);
+// it is not tied to the operating range (DS1923: -41°C, range from -20°C).
 var devices = map[deviceId]struct {
 	name      string
 	offset    float32
 	supported bool
 	tr1       Temperature
+	min       Temperature
+	max       Temperature
 }{
-	DS2422:  {"DS2422", 0.0, false, 0.0},
-	DS1923:  {"DS1923", 0.0, false, 0.0},
-	DS1922L: {"DS1922L", -41.0, true, 60.0},
-	DS1922T: {"DS1922T", -1.0, true, 90.0},
-	DS1922E: {"DS1922E", 0.0, false, 0.0},
+	DS2422:  {"DS2422", 0.0, false, 0.0, 0.0, 0.0},
+	DS1923:  {"DS1923", -41.0, true, 60.0, -20.0, 85.0},
+	DS1922L: {"DS1922L", -41.0, true, 60.0, -40.0, 85.0},
+	DS1922T: {"DS1922T", -1.0, true, 90.0, 0.0, 125.0},
+	DS1922E: {"DS1922E", 14.0, true, 125.0, 15.0, 140.0},
 }
 
 // 1-Wire device path
 const W1_DIR = "/sys/bus/w1/devices"
 
+// iButton family code
+const FAMILY = 0x41
+
 // Button represents an iButton
 type Button struct {
-	file *os.File
+
+	// Now is the host clock, time.Now if nil
+	Now func() time.Time
+
+	transport Transport
+	rom       ROM
+	password  Password
+	location  *time.Location
+
+	// CRC retry settings and the count of retried pages
+	retries int
+	backoff time.Duration
+	retried int
+
+	// ReadLog progress hook
+	progress func(read, total int)
+}
+
+// NewButton returns the iButton with the given ROM id on the given transport
+func NewButton(transport Transport, rom ROM) *Button {
+
+	return &Button{transport: transport, rom: rom}
+}
+
+// now the current host time
+func (b *Button) now() time.Time {
+
+	if b.Now == nil {
+		return time.Now()
+	}
+
+	return b.Now()
 }
 
-// Sample represents a mission log sample
+// SetLocation sets the time zone the iButton clock runs in (time.Local by
+// default). The clock is set and read as wall clock time in this location.
+func (b *Button) SetLocation(location *time.Location) {
+
+	b.location = location
+}
+
+// SetRetries sets how often a page failing its CRC check is read again
+// (none by default). The read resumes at the failing page after waiting the
+// given backoff, which doubles with every further attempt at the same page.
+func (b *Button) SetRetries(retries int, backoff time.Duration) {
+
+	b.retries = retries
+	b.backoff = backoff
+}
+
+// SetProgress sets a function ReadLog calls after every log page it read,
+// with the count of pages read so far and the total count of log pages
+func (b *Button) SetProgress(progress func(read, total int)) {
+
+	b.progress = progress
+}
+
+// RetriedPages the count of page reads retried after a failed CRC check
+// since the button was created
+func (b *Button) RetriedPages() int {
+
+	return b.retried
+}
+
+// Location the time zone the iButton clock runs in
+func (b *Button) Location() *time.Location {
+
+	if b.location == nil {
+		return time.Local
+	}
+
+	return b.location
+}
+
+// Sample represents a mission log sample. Temp and Humidity are only set
+// for the channels the mission logs.
 type Sample struct {
-	Time time.Time
-	Temp Temperature
+	Time     time.Time
+	Temp     Temperature
+	Humidity Humidity
 }
 
 // Temperature represents a temperature
@@ -84,179 +167,340 @@ type Temperature float32
 // Status returns the current iButton status
 func (b *Button) Status() (status *Status, err error) {
 
-	status = new(Status)
+	return b.StatusContext(context.Background())
+}
+
+// StatusContext is Status, giving up once the context is done
+func (b *Button) StatusContext(ctx context.Context) (status *Status, err error) {
+
+	status = &Status{rom: b.rom, location: b.location, hostTime: b.now()}
 
-	status.bytes, err = b.readMemory(0x0200, 3)
+	status.bytes, err = b.readMemoryContext(ctx, 0x0200, 3)
 	if err != nil {
 		return
 	}
 
+	return status, status.supported()
+}
+
+// ButtonInfo describes an iButton found on the bus
+type ButtonInfo struct {
+	ROM   ROM
+	Model string
+}
+
+// Enumerate lists all iButtons on the given bus. The model of password
+// protected buttons can not be read and is reported as unknown.
+func Enumerate(transport Transport) (infos []ButtonInfo, err error) {
+
+	roms, err := transport.Search()
+	if err != nil {
+		return
+	}
+
+	// filter family 41 (iButton) devices
+	for _, rom := range roms {
+		if rom.Family() != FAMILY {
+			continue
+		}
+
+		info := ButtonInfo{ROM: rom, Model: "unknown"}
+		status, err := NewButton(transport, rom).Status()
+		if err == nil || errors.Is(err, ErrUnsupportedDevice) {
+			info.Model = status.Name()
+		}
+		infos = append(infos, info)
+	}
+
 	return
 }
 
-// Open opens this iButton's 1-Wire session
+// Open opens the single iButton's 1-Wire session on the w1 sysfs bus
 func (b *Button) Open() (err error) {
 
-	// open devices directory
-	dir, err := os.Open(W1_DIR)
+	return b.OpenTransport(new(SysfsTransport))
+}
+
+// OpenContext is Open, giving up once the context is done
+func (b *Button) OpenContext(ctx context.Context) (err error) {
+
+	return b.OpenTransportContext(ctx, new(SysfsTransport))
+}
+
+// OpenTransport opens the 1-Wire session of the single iButton on the given
+// transport. It fails with ErrNoDevice or ErrMultipleDevices otherwise.
+func (b *Button) OpenTransport(transport Transport) (err error) {
+
+	rom, err := searchButton(transport)
 	if err != nil {
 		return
 	}
 
-	// get devices directory contents
-	infos, err := dir.Readdir(0)
+	return b.open(transport, rom)
+}
+
+// OpenTransportContext is OpenTransport, giving up once the context is
+// done. The Transport takes no context, so a search or select blocked beyond
+// that is abandoned and the transport closed.
+func (b *Button) OpenTransportContext(ctx context.Context, transport Transport) (err error) {
+
+	err = ctx.Err()
+	if err != nil {
+		return
+	}
+
+	type result struct {
+		rom ROM
+		err error
+	}
+	done := make(chan result, 1)
+	go func() {
+		rom, err := searchButton(transport)
+		if err == nil {
+			err = transport.Select(rom)
+		}
+		done <- result{rom, err}
+	}()
+
+	select {
+	case r := <-done:
+		if r.err != nil {
+			return r.err
+		}
+		b.transport = transport
+		b.rom = r.rom
+	case <-ctx.Done():
+		transport.Close()
+		err = ctx.Err()
+	}
+
+	return
+}
+
+// searchButton returns the ROM id of the single iButton on the given
+// transport, failing with ErrNoDevice or ErrMultipleDevices otherwise
+func searchButton(transport Transport) (rom ROM, err error) {
+
+	roms, err := transport.Search()
 	if err != nil {
 		return
 	}
 
-	// filter familty 41 (iButton) devices
-	var buttonInfo os.FileInfo
-	for _, info := range infos {
-		if strings.Index(info.Name(), "41") == 0 {
-			if buttonInfo != nil {
-				return errors.New("Multiple iButtons found - ibutton only supports working with a single device.")
+	// filter family 41 (iButton) devices
+	var buttonRom *ROM
+	for i, rom := range roms {
+		if rom.Family() == FAMILY {
+			if buttonRom != nil {
+				return rom, ErrMultipleDevices
 			}
 
-			buttonInfo = info
+			buttonRom = &roms[i]
 		}
 	}
-	if buttonInfo == nil {
-		return errors.New("No iButton found.")
+	if buttonRom == nil {
+		return rom, ErrNoDevice
 	}
 
-	b.file, err = os.OpenFile(W1_DIR+"/"+buttonInfo.Name()+"/rw", os.O_RDWR, 0666)
+	return *buttonRom, nil
+}
+
+// OpenByID opens the 1-Wire session of the iButton with the given ROM id
+// (e.g. "41-00000012ab34") on the w1 sysfs bus
+func (b *Button) OpenByID(id string) (err error) {
+
+	rom, err := ParseROM(id)
+	if err != nil {
+		return
+	}
+	if rom.Family() != FAMILY {
+		return fmt.Errorf("%w: %v is not an iButton", ErrUnsupportedDevice, rom)
+	}
 
-	return err
+	return b.open(new(SysfsTransport), rom)
+}
+
+// open selects the iButton with the given ROM id on the given transport
+func (b *Button) open(transport Transport, rom ROM) (err error) {
+
+	err = transport.Select(rom)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%w: %v is not on the bus", ErrNoDevice, rom)
+	}
+	if err != nil {
+		return
+	}
+
+	b.transport = transport
+	b.rom = rom
+
+	return
 }
 
 // Close closes this iButton's 1-Wire session
 func (b *Button) Close() (err error) {
 
-	if b.file == nil {
+	if b.transport == nil {
 		return
 	}
 
-	return b.file.Close()
+	return b.transport.Close()
 }
 
-// reset send a reset command to the 1-Wire bus
-func (b *Button) reset() (err error) {
+// ROM the iButton's ROM id
+func (b *Button) ROM() ROM {
+
+	return b.rom
+}
 
-	// send empty write to reset
-	data := make([]byte, 0)
-	_, err = b.file.Write(data)
+// command addresses the iButton and sends the given command bytes
+func (b *Button) command(data []byte) (err error) {
 
-	return err
+	if b.transport == nil {
+		return fmt.Errorf("%w: iButton session not open", ErrNoDevice)
+	}
+
+	err = b.transport.Select(b.rom)
+	if err != nil {
+		return
+	}
+
+	return b.transport.Write(data)
+}
+
+// reset sends a reset to the 1-Wire bus
+func (b *Button) reset() (err error) {
+
+	return b.transport.Reset()
 }
 
 // StopMission stops the currently running mission
 func (b *Button) StopMission() (err error) {
 
+	return b.StopMissionContext(context.Background())
+}
+
+// StopMissionContext is StopMission, failing without sending the command once the context is done
+func (b *Button) StopMissionContext(ctx context.Context) (err error) {
+
+	err = ctx.Err()
+	if err != nil {
+		return
+	}
+
 	data := make([]byte, 10)
 	data[0] = STOP_MISSION
+	copy(data[1:9], b.password[:])
 	data[9] = 0xFF
-	_, err = b.file.Write(data)
 
-	return err
+	return b.command(data)
 }
 
 // ClearMemory clears the ibutton memory
 func (b *Button) ClearMemory() (err error) {
 
+	return b.ClearMemoryContext(context.Background())
+}
+
+// ClearMemoryContext is ClearMemory, failing without sending the command once the context is done
+func (b *Button) ClearMemoryContext(ctx context.Context) (err error) {
+
+	err = ctx.Err()
+	if err != nil {
+		return
+	}
+
 	data := make([]byte, 10)
 	data[0] = CLEAR_MEMORY
+	copy(data[1:9], b.password[:])
 	data[9] = 0xFF
-	_, err = b.file.Write(data)
 
-	return err
+	return b.command(data)
 }
 
-// StartMission starts a mission
-func (b *Button) StartMission() (err error) {
+// startMission sends the start mission command
+func (b *Button) startMission() (err error) {
 
 	data := make([]byte, 10)
 	data[0] = START_MISSION
+	copy(data[1:9], b.password[:])
 	data[9] = 0xFF
-	_, err = b.file.Write(data)
 
-	return err
+	return b.command(data)
 }
 
 // CopyScratchmap copies the scratchpad
 func (b *Button) CopyScratchpad() (err error) {
 
-	data := make([]byte, 12)
-	data[0] = COPY_SCRATCHPAD
-	data[1] = 0x00
-	data[2] = 0x02
-	data[3] = 0x1F
-	_, err = b.file.Write(data)
-
-	return err
+	return b.copyScratchpad(0x0200, 0x1F)
 }
 
-// WriteScratchpad writes the button scrathpad
-func (b *Button) WriteScratchpad() (err error) {
+// copyScratchpad copies the scratchpad written to the given target address
+// up to the given ending offset
+func (b *Button) copyScratchpad(address uint16, es byte) (err error) {
 
-	data := make([]byte, 35)
+	data := make([]byte, 12)
+	data[0] = COPY_SCRATCHPAD
+	data[1] = byte(address)
+	data[2] = byte(address >> 8)
+	data[3] = es
+	copy(data[4:12], b.password[:])
 
-	// command
-	data[0] = WRITE_SCRATCHPAD
+	return b.command(data)
+}
 
-	// target address (scratchpad)
-	data[1] = 0x00
-	data[2] = 0x02
+// writeRegisters writes the given bytes to the memory at the given address
+// through the scratchpad, verifying the scratchpad before copying it
+func (b *Button) writeRegisters(address uint16, data []byte) (err error) {
 
-	// time and date (01.04.2013 15:30:00)
-	// strange format, so: 30 -> "30" -> 0x30
-	now := time.Now()
-	second, _ := strconv.ParseInt(strconv.Itoa(now.Second()),16,8)
-	minute, _ := strconv.ParseInt(strconv.Itoa(now.Minute()),16,8)
-	hour, _ := strconv.ParseInt(strconv.Itoa(now.Hour()),16,8)
-	data[3] = byte(second)
-	data[4] = byte(minute)
-	data[5] = byte(hour)
-	data[6] = byte(now.Day())
-	data[7] = byte(now.Month())
-	data[8] = byte(now.Year() % 100)
+	cmd := make([]byte, 3, 3+len(data))
+	cmd[0] = WRITE_SCRATCHPAD
+	cmd[1] = byte(address)
+	cmd[2] = byte(address >> 8)
+	cmd = append(cmd, data...)
+	err = b.command(cmd)
+	if err != nil {
+		return
+	}
 
-	// sample rate (10mins with EHSS=0)
-	data[ 9] = 0x0A
-	data[10] = 0x00
+	// verify target address, ending offset and data
+	es := byte(address&0x1F) + byte(len(data)) - 1
+	scratchpad, err := b.ReadScratchpad()
+	if err != nil {
+		return
+	}
+	if scratchpad[0] != cmd[1] || scratchpad[1] != cmd[2] || scratchpad[2] != es || !bytes.Equal(scratchpad[3:3+len(data)], data) {
+		return fmt.Errorf("scratchpad verification failed (%v)", scratchpad)
+	}
 
-	// alarm thresholds
-	data[11] = 0x52
-	data[12] = 0x99
+	return b.copyScratchpad(address, es)
+}
 
-	// alarm control (both disabled = 0)
-	data[19] = 0x00
+// WriteScratchpad writes the given mission parameters to the button scrathpad
+func (b *Button) WriteScratchpad(config MissionConfig) (err error) {
 
-	// "Disabled" - registers is R/W but should be 0xfc
-	data[20] = 0xFC
+	// the register encoding depends on the device model
+	status, err := b.Status()
+	if err != nil {
+		return
+	}
 
-	// EHSS=0 (low sample rate), EOSC=1 (oscillator running)
-	data[21] = 0x01
+	registers, err := config.registers(status.DeviceId(), b.now().In(status.Location()), status.hour12())
+	if err != nil {
+		return
+	}
 
-	// no alarm, no rollover, 16 bit, logging on
-	data[22] = 0xC5
+	data := make([]byte, 3, 35)
 
-	// no mission start delay
-	data[25] = 0x00
-	data[26] = 0x00
-	data[27] = 0x00
+	// command
+	data[0] = WRITE_SCRATCHPAD
 
-	// "write through the end of the scratchpad"
-	data[28] = 0xFF
-	data[29] = 0xFF
-	data[30] = 0xFF
-	data[31] = 0xFF
-	data[32] = 0xFF
-	data[33] = 0xFF
-	data[34] = 0xFF
+	// target address (scratchpad)
+	data[1] = 0x00
+	data[2] = 0x02
 
-	_, err = b.file.Write(data)
+	data = append(data, registers...)
 
-	return err
+	return b.command(data)
 }
 
 // ReadScratchpad reads the button scrathpad
@@ -265,14 +509,14 @@ func (b *Button) ReadScratchpad() (data []byte, err error) {
 	// send the read scratchpad command
 	cmd := make([]byte, 1)
 	cmd[0] = READ_SCRATCHPAD
-	_, err = b.file.Write(cmd)
+	err = b.command(cmd)
 	if err != nil {
 		return
 	}
 
 	// read the initial package which has special parsing
 	data = make([]byte, 35)
-	_, err = b.file.Read(data)
+	err = b.transport.Read(data)
 	if err != nil {
 		return
 	}
@@ -286,70 +530,177 @@ func (b *Button) ReadScratchpad() (data []byte, err error) {
 // ReadLog returns the log entries for the current mission
 func (b *Button) ReadLog() (samples []Sample, err error) {
 
-	// aquire button status
-	status, err := b.Status()
+	return b.ReadLogContext(context.Background())
+}
+
+// ReadLogContext is ReadLog, giving up between two pages once the context is done
+func (b *Button) ReadLogContext(ctx context.Context) (samples []Sample, err error) {
+
+	reader, err := b.NewSampleReader(ctx)
 	if err != nil {
 		return
 	}
+	reader.Progress = b.progress
 
-	// make array with sample count length
-	samples = make([]Sample, status.SampleCount())
+	return reader.readAll()
+}
+
+// crcError the error for the given page failing its CRC check, which is a
+// missing or invalid password if the iButton sent all ones
+func crcError(data []byte, address uint16, page int) error {
 
-	// determine temperature sample size
-	var sampleBytes uint32
-	if status.HighResolution() {
-		sampleBytes = 2
-	} else {
-		sampleBytes = 1
+	if denied(data) {
+		return ErrPasswordRequired
 	}
 
-	// determine page count
-	byteCount := status.SampleCount() * sampleBytes
-	pages := int(byteCount / 32)
-	if byteCount%32 != 0 {
-		pages += 1
+	return &CRCError{Address: address + uint16(page)*32, Page: page}
+}
+
+// memory is a source of iButton memory pages, a live device or a memory image
+type memory interface {
+	readMemory(address uint16, pages int) ([]byte, error)
+}
+
+// contextMemory reads the memory of a live device with a context, calling
+// page after every page read if set
+type contextMemory struct {
+	ctx    context.Context
+	button *Button
+	page   func()
+}
+
+func (m contextMemory) readMemory(address uint16, pages int) ([]byte, error) {
+
+	return m.button.readMemoryPages(m.ctx, address, pages, m.page)
+}
+
+// logDecoder decodes the samples of a mission in chronological order
+type logDecoder struct {
+	status     *Status
+	first      uint32
+	A, B, C    Temperature
+	hA, hB, hC Humidity
+}
+
+// newLogDecoder returns the decoder for the mission described by the given status
+func newLogDecoder(status *Status) (d *logDecoder) {
+
+	d = &logDecoder{status: status}
+	d.first, _ = status.logWindow()
+	if status.TemperatureLogging() {
+		d.A, d.B, d.C = status.correctionFactors()
+	}
+	if status.HumidityLogging() {
+		d.hA, d.hB, d.hC = status.humidityCorrectionFactors()
 	}
 
-	// read pages from device memory
-	bytes, err := b.readMemory(0x1000, pages)
-	if err != nil {
-		return
+	return
+}
+
+// decode decodes the sample with the given index (0 for the oldest surviving
+// sample) from its raw temperature and humidity bytes
+func (d *logDecoder) decode(index uint32, temperature []byte, humidity []byte) (sample Sample) {
+
+	sample.Time = d.status.MissionTimestamp().Add(d.status.SampleRate() * time.Duration(d.first+index))
+
+	// temperature correction
+	if temperature != nil {
+		tc := d.status.decodeTemp(temperature)
+		sample.Temp = tc - (d.A*tc*tc + d.B*tc + d.C)
+	}
+
+	// humidity correction, compensating with the logged temperature
+	if humidity != nil {
+		temp := Temperature(REFERENCE_TEMPERATURE)
+		if temperature != nil {
+			temp = sample.Temp
+		}
+		hc := decodeHumidity(humidity)
+		sample.Humidity = compensateHumidity(hc-(d.hA*hc*hc+d.hB*hc+d.hC), temp)
 	}
 
-	// get temperature correction factors
-	A, B, C := status.correctionFactors()
+	return
+}
 
-	// parse temperatures
-	for index := uint32(0); index < status.SampleCount(); index++ {
+// readMemory reads the given number of pages of the iButton's memory starting
+// with the given address
+func (b *Button) readMemory(address uint16, pages int) (bytes []byte, err error) {
 
-		samples[index].Time = status.MissionTimestamp().Add(status.SampleRate() * time.Duration(index))
+	return b.readMemoryContext(context.Background(), address, pages)
+}
+
+// readMemoryContext reads the given number of pages of the iButton's memory
+// starting with the given address, giving up between two pages once the
+// context is done. Pages failing their CRC check are retried up to the
+// configured number of times, resuming the read at the failing page.
+func (b *Button) readMemoryContext(ctx context.Context, address uint16, pages int) (bytes []byte, err error) {
+
+	return b.readMemoryPages(ctx, address, pages, nil)
+}
 
-		temperatureBytes := bytes[index*sampleBytes : (index+1)*sampleBytes]
+// readMemoryPages is readMemoryContext, calling page (if not nil) once for
+// every page passing its CRC check
+func (b *Button) readMemoryPages(ctx context.Context, address uint16, pages int, page func()) (bytes []byte, err error) {
 
-		tc := status.decodeTemp(temperatureBytes)
-		samples[index].Temp = tc - (A*tc*tc + B*tc + C)
+	attempts, failed := 0, -1
+	for {
+		done := len(bytes) / 32
+		var data []byte
+		data, err = b.readPages(ctx, address+uint16(done)*32, pages-done, page)
+		bytes = append(bytes, data...)
 
+		var crcErr *CRCError
+		if !errors.As(err, &crcErr) {
+			break
+		}
+		crcErr.Page += done
+
+		// count the attempts per failing page
+		if crcErr.Page != failed {
+			attempts, failed = 0, crcErr.Page
+		}
+		if attempts >= b.retries {
+			break
+		}
+		b.reset()
+		select {
+		case <-time.After(b.backoff << uint(attempts)):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		attempts++
+		b.retried++
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return
 }
 
-// ReadMemory reads the iButton's memory starting with the given address
-func (b *Button) readMemory(address uint16, pages int) (bytes []byte, err error) {
+// readPages reads the given number of pages starting with the given address,
+// returning the pages read before a failing CRC check with its error
+func (b *Button) readPages(ctx context.Context, address uint16, pages int, page func()) (bytes []byte, err error) {
+
+	err = ctx.Err()
+	if err != nil {
+		return
+	}
 
 	// send the read command
 	cmd := make([]byte, 11)
 	cmd[0] = READ_MEMORY
 	cmd[1] = byte(address)
 	cmd[2] = byte(address >> 8)
-	_, err = b.file.Write(cmd)
+	copy(cmd[3:11], b.password[:])
+	err = b.command(cmd)
 	if err != nil {
 		return
 	}
 
 	// read the initial package which has special parsing
 	data := make([]byte, 34)
-	_, err = b.file.Read(data)
+	err = b.transport.Read(data)
 	if err != nil {
 		return
 	}
@@ -358,24 +709,33 @@ func (b *Button) readMemory(address uint16, pages int) (bytes []byte, err error)
 	copy(initial[3:], data[:32])
 	checksum := 0xffff ^ (uint16(data[33])<<8 + uint16(data[32]))
 	if crc16.Checksum(initial) != checksum {
-		err = errors.New("crc check failed in initial read")
-		return
+		return bytes, crcError(data, address, 0)
 	}
 	bytes = append(bytes, data[:32]...)
+	if page != nil {
+		page()
+	}
 
 	// read remaining pages
-	for pages--; pages > 0; pages-- {
+	for i := 1; i < pages; i++ {
+		err = ctx.Err()
+		if err != nil {
+			b.reset()
+			return nil, err
+		}
 		data := make([]byte, 34)
-		_, err = b.file.Read(data)
+		err = b.transport.Read(data)
 		if err != nil {
 			return
 		}
 		checksum := 0xffff ^ (uint16(data[33])<<8 + uint16(data[32]))
 		if crc16.Checksum(data[:32]) != checksum {
-			err = errors.New("crc check failed failed in subsequent read")
-			return
+			return bytes, crcError(data, address, i)
 		}
 		bytes = append(bytes, data[:32]...)
+		if page != nil {
+			page()
+		}
 	}
 
 	// tell the device to stop sending data
@@ -0,0 +1,449 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"context"
+	"errors"
+	"github.com/maxhille/go-ibutton/emulator"
+	"github.com/maxhille/go-ibutton/w1"
+	"math"
+	"testing"
+	"time"
+)
+
+// clock is a settable time source for the emulated devices
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+// newButton returns a button attached to an emulated device of the given model
+func newButton(model byte) (*w1.Button, *emulator.Device, *clock) {
+	c := &clock{time.Date(2013, 4, 1, 15, 30, 0, 0, time.Local)}
+	device := emulator.NewDevice(model, 0x12ab34)
+	device.Now = c.Now
+	button := w1.NewButton(emulator.NewBus(device), device.ROM())
+	button.Now = c.Now
+	return button, device, c
+}
+
+// startMission starts a mission with the default parameters
+func startMission(t *testing.T, button *w1.Button) {
+	startMissionConfig(t, button, w1.DefaultMissionConfig)
+}
+
+// startMissionConfig starts a mission with the given parameters
+func startMissionConfig(t *testing.T, button *w1.Button, config w1.MissionConfig) {
+	if err := button.StartMission(config); err != nil {
+		t.Fatalf("StartMission() = %v", err)
+	}
+}
+
+func TestStatus(t *testing.T) {
+	button, _, _ := newButton(w1.DS1922L)
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if x := status.Name(); x != "DS1922L" {
+		t.Errorf("Name() = %v, want DS1922L", x)
+	}
+	if status.MissionInProgress() {
+		t.Errorf("MissionInProgress() = true, want false")
+	}
+	if !status.MemoryCleared() {
+		t.Errorf("MemoryCleared() = false, want true")
+	}
+}
+
+func TestMission(t *testing.T) {
+	button, device, c := newButton(w1.DS1922T)
+	start := c.now
+	device.Temperature = func(t time.Time) float64 {
+		return 40 + t.Sub(start).Minutes()/4
+	}
+	startMission(t, button)
+
+	c.now = c.now.Add(35 * time.Minute)
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if !status.MissionInProgress() {
+		t.Errorf("MissionInProgress() = false, want true")
+	}
+	if status.MemoryCleared() {
+		t.Errorf("MemoryCleared() = true, want false")
+	}
+	if x := status.SampleRate(); x != 10*time.Minute {
+		t.Errorf("SampleRate() = %v, want 10m", x)
+	}
+	if !status.HighResolution() {
+		t.Errorf("HighResolution() = false, want true")
+	}
+
+	samples, err := button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+	if len(samples) != 4 {
+		t.Fatalf("len(ReadLog()) = %v, want 4", len(samples))
+	}
+	for i, sample := range samples {
+		if i > 0 && sample.Time.Sub(samples[i-1].Time) != 10*time.Minute {
+			t.Errorf("sample %v at %v, want 10m after %v", i, sample.Time, samples[i-1].Time)
+		}
+		want := 40 + float64(10*i)/4
+		if math.Abs(float64(sample.Temp)-want) > 0.0625 {
+			t.Errorf("sample %v = %v°C, want %v°C", i, sample.Temp, want)
+		}
+	}
+
+	if err := button.StopMission(); err != nil {
+		t.Fatalf("StopMission() = %v", err)
+	}
+	c.now = c.now.Add(time.Hour)
+	status, err = button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if status.MissionInProgress() {
+		t.Errorf("MissionInProgress() = true after StopMission()")
+	}
+	if x := status.SampleCount(); x != 4 {
+		t.Errorf("SampleCount() = %v after StopMission(), want 4", x)
+	}
+}
+
+func TestReadLogPages(t *testing.T) {
+	button, _, c := newButton(w1.DS1922L)
+	startMission(t, button)
+
+	// 100 16 bit samples span 7 pages
+	c.now = c.now.Add(99*10*time.Minute + time.Second)
+	samples, err := button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+	if len(samples) != 100 {
+		t.Fatalf("len(ReadLog()) = %v, want 100", len(samples))
+	}
+	for i, sample := range samples {
+		if math.Abs(float64(sample.Temp)-20) > 0.0625 {
+			t.Errorf("sample %v = %v°C, want 20°C", i, sample.Temp)
+		}
+	}
+}
+
+func TestClearMemoryDuringMission(t *testing.T) {
+	button, _, c := newButton(w1.DS1922L)
+	startMission(t, button)
+	c.now = c.now.Add(time.Hour)
+
+	if err := button.ClearMemory(); err != nil {
+		t.Fatalf("ClearMemory() = %v", err)
+	}
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if status.MemoryCleared() || status.SampleCount() != 7 {
+		t.Errorf("ClearMemory() during mission cleared the log")
+	}
+}
+
+func TestEnumerate(t *testing.T) {
+	logger := emulator.NewDevice(w1.DS1922L, 0x01)
+	hygrochron := emulator.NewDevice(w1.DS1923, 0x02)
+	locked := emulator.NewDevice(w1.DS1922T, 0x03)
+	bus := emulator.NewBus(logger, hygrochron, locked)
+
+	full, _ := w1.NewPassword("owner")
+	button := w1.NewButton(bus, locked.ROM())
+	if err := button.SetPasswords(full, full); err != nil {
+		t.Fatalf("SetPasswords() = %v", err)
+	}
+	if err := button.EnablePasswords(); err != nil {
+		t.Fatalf("EnablePasswords() = %v", err)
+	}
+
+	infos, err := w1.Enumerate(bus)
+	if err != nil {
+		t.Fatalf("Enumerate() = %v", err)
+	}
+	want := []w1.ButtonInfo{
+		{logger.ROM(), "DS1922L"},
+		{hygrochron.ROM(), "DS1923"},
+		{locked.ROM(), "unknown"},
+	}
+	if len(infos) != len(want) {
+		t.Fatalf("Enumerate() = %v, want %v", infos, want)
+	}
+	for i := range want {
+		if infos[i] != want[i] {
+			t.Errorf("Enumerate()[%v] = %v, want %v", i, infos[i], want[i])
+		}
+	}
+}
+
+func TestReadLogRollover(t *testing.T) {
+	tests := []struct {
+		config    w1.MissionConfig
+		elapsed   time.Duration
+		count     uint32
+		surviving int
+	}{
+		{w1.MissionConfig{SampleRate: time.Second, LogTemperature: true, Rollover: true}, 9999 * time.Second, 10000, 8192},
+		{w1.MissionConfig{SampleRate: time.Second, LogTemperature: true, HighResolution: true, Rollover: true}, 4099 * time.Second, 4100, 4096},
+		{w1.MissionConfig{SampleRate: time.Second, LogTemperature: true, HighResolution: true}, 9999 * time.Second, 4096, 4096},
+	}
+
+	for _, test := range tests {
+		button, device, c := newButton(w1.DS1922L)
+		start := c.now
+		temperature := func(t time.Time) float64 {
+			return -40 + float64(int(t.Sub(start).Seconds())%200)/2
+		}
+		device.Temperature = temperature
+		startMissionConfig(t, button, test.config)
+		c.now = c.now.Add(test.elapsed)
+
+		status, err := button.Status()
+		if err != nil {
+			t.Fatalf("Status() = %v", err)
+		}
+		if x := status.SampleCount(); x != test.count {
+			t.Errorf("%+v: SampleCount() = %v, want %v", test.config, x, test.count)
+		}
+		if x := status.RolledOver(); x != test.config.Rollover {
+			t.Errorf("%+v: RolledOver() = %v, want %v", test.config, x, test.config.Rollover)
+		}
+
+		samples, err := button.ReadLog()
+		if err != nil {
+			t.Fatalf("ReadLog() = %v", err)
+		}
+		if len(samples) != test.surviving {
+			t.Fatalf("%+v: len(ReadLog()) = %v, want %v", test.config, len(samples), test.surviving)
+		}
+		first := status.MissionTimestamp().Add(time.Duration(test.count-uint32(test.surviving)) * time.Second)
+		if x := samples[0].Time; !x.Equal(first) {
+			t.Errorf("%+v: oldest sample at %v, want %v", test.config, x, first)
+		}
+		for i, sample := range samples {
+			want := temperature(start.Add(sample.Time.Sub(status.MissionTimestamp())))
+			if math.Abs(float64(sample.Temp)-want) > 0.0625 {
+				t.Errorf("%+v: sample %v = %v°C, want %v°C", test.config, i, sample.Temp, want)
+				break
+			}
+		}
+	}
+}
+
+// flakyBus corrupts every nth page read (34 bytes of data and CRC)
+type flakyBus struct {
+	w1.Transport
+	every int
+	pages int
+}
+
+func (b *flakyBus) Read(data []byte) error {
+	err := b.Transport.Read(data)
+	if len(data) == 34 {
+		b.pages++
+		if b.pages%b.every == 0 {
+			data[0] ^= 0x01
+		}
+	}
+	return err
+}
+
+func TestReadLogRetry(t *testing.T) {
+	button, device, c := newButton(w1.DS1922L)
+	start := c.now
+	device.Temperature = func(t time.Time) float64 {
+		return float64(int(t.Sub(start).Seconds())%100) / 2
+	}
+	startMissionConfig(t, button, w1.MissionConfig{SampleRate: time.Second, LogTemperature: true})
+	c.now = c.now.Add(time.Hour)
+	want, err := button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+
+	// without retries the first corrupted page fails the read
+	bus := &flakyBus{Transport: emulator.NewBus(device), every: 50}
+	flaky := w1.NewButton(bus, device.ROM())
+	_, err = flaky.ReadLog()
+	var crcErr *w1.CRCError
+	if !errors.As(err, &crcErr) {
+		t.Fatalf("ReadLog() = %v, want *CRCError", err)
+	}
+	if crcErr.Address != 0x1000+uint16(crcErr.Page)*32 || crcErr.Page != 46 {
+		t.Errorf("CRCError = %+v, want page 46 at %#04x", crcErr, 0x1000+46*32)
+	}
+
+	// retries resume at the corrupted pages
+	bus.pages = 0
+	flaky.SetRetries(2, time.Millisecond)
+	samples, err := flaky.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() with retries = %v", err)
+	}
+	if x := flaky.RetriedPages(); x != 2 {
+		t.Errorf("RetriedPages() = %v, want 2", x)
+	}
+	if len(samples) != len(want) {
+		t.Fatalf("len(ReadLog()) = %v, want %v", len(samples), len(want))
+	}
+	for i := range samples {
+		if samples[i] != want[i] {
+			t.Fatalf("sample %v = %+v, want %+v", i, samples[i], want[i])
+		}
+	}
+}
+
+// cancelingBus cancels a context after the given number of page reads
+type cancelingBus struct {
+	w1.Transport
+	cancel func()
+	after  int
+	pages  int
+}
+
+func (b *cancelingBus) Read(data []byte) error {
+	b.pages++
+	if b.pages == b.after {
+		b.cancel()
+	}
+	return b.Transport.Read(data)
+}
+
+func TestContext(t *testing.T) {
+	button, device, c := newButton(w1.DS1922L)
+	startMissionConfig(t, button, w1.MissionConfig{SampleRate: time.Second, LogTemperature: true})
+	c.now = c.now.Add(time.Hour)
+
+	// nothing is sent once the context is done
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := button.StatusContext(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("StatusContext() = %v, want context.Canceled", err)
+	}
+	if err := button.StopMissionContext(canceled); !errors.Is(err, context.Canceled) {
+		t.Errorf("StopMissionContext() = %v, want context.Canceled", err)
+	}
+	var startErr *w1.StartError
+	if err := button.StartMissionContext(canceled, w1.DefaultMissionConfig); !errors.As(err, &startErr) || !errors.Is(err, context.Canceled) {
+		t.Errorf("StartMissionContext() = %v, want *StartError with context.Canceled", err)
+	}
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if !status.MissionInProgress() {
+		t.Errorf("MissionInProgress() = false after canceled StopMissionContext()")
+	}
+
+	// reads stop between two pages
+	ctx, cancel := context.WithCancel(context.Background())
+	bus := &cancelingBus{Transport: emulator.NewBus(device), cancel: cancel, after: 10}
+	if _, err := w1.NewButton(bus, device.ROM()).ReadLogContext(ctx); !errors.Is(err, context.Canceled) {
+		t.Errorf("ReadLogContext() = %v, want context.Canceled", err)
+	}
+	if bus.pages != 10 {
+		t.Errorf("ReadLogContext() read %v pages after cancel at page 10", bus.pages)
+	}
+}
+
+// blockingBus blocks Search until released and records Close
+type blockingBus struct {
+	w1.Transport
+	release chan struct{}
+	closed  bool
+}
+
+func (b *blockingBus) Search() ([]w1.ROM, error) {
+	<-b.release
+	return b.Transport.Search()
+}
+
+func (b *blockingBus) Close() error {
+	b.closed = true
+	return b.Transport.Close()
+}
+
+func TestOpenContext(t *testing.T) {
+	device := emulator.NewDevice(w1.DS1922L, 0x12ab34)
+
+	button := new(w1.Button)
+	if err := button.OpenTransportContext(context.Background(), emulator.NewBus(device)); err != nil {
+		t.Fatalf("OpenTransportContext() = %v", err)
+	}
+	if button.ROM() != device.ROM() {
+		t.Errorf("ROM() = %v, want %v", button.ROM(), device.ROM())
+	}
+
+	// a blocked search is abandoned at the deadline
+	bus := &blockingBus{Transport: emulator.NewBus(device), release: make(chan struct{})}
+	defer close(bus.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	button = new(w1.Button)
+	if err := button.OpenTransportContext(ctx, bus); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("OpenTransportContext() = %v, want context.DeadlineExceeded", err)
+	}
+	if !bus.closed {
+		t.Errorf("OpenTransportContext() left the abandoned transport open")
+	}
+	if button.ROM() != (w1.ROM{}) {
+		t.Errorf("ROM() = %v after the abandoned open", button.ROM())
+	}
+}
+
+func TestReadLogProgress(t *testing.T) {
+	button, device, c := newButton(w1.DS1923)
+	startMissionConfig(t, button, w1.MissionConfig{SampleRate: time.Second, LogTemperature: true, LogHumidity: true,
+		HighResolution: true})
+	c.now = c.now.Add(time.Hour)
+
+	// progress counts every log page once, retried ones included
+	bus := &flakyBus{Transport: emulator.NewBus(device), every: 40}
+	button = w1.NewButton(bus, device.ROM())
+	button.SetRetries(1, 0)
+	calls, read, total := 0, 0, 0
+	button.SetProgress(func(r, t int) {
+		calls++
+		read, total = r, t
+	})
+	if _, err := button.ReadLog(); err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+
+	// the full split log, 2048 samples of 2 temperature and 1 humidity bytes
+	if calls != 192 || read != 192 || total != 192 {
+		t.Errorf("%v progress calls, last %v/%v, want 192 calls, last 192/192", calls, read, total)
+	}
+	if button.RetriedPages() == 0 {
+		t.Errorf("RetriedPages() = 0, want retries")
+	}
+}
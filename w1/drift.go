@@ -0,0 +1,58 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"time"
+)
+
+// HostTime the host time the status was read at, the download time for
+// memory images
+func (s *Status) HostTime() time.Time {
+
+	return s.hostTime
+}
+
+// Drift how far the iButton clock is ahead of the host clock (negative if
+// behind), measured when the status was read. The iButton clock only
+// counts whole seconds, so the host time is truncated to seconds as well.
+func (s *Status) Drift() time.Duration {
+
+	return s.Time().Sub(s.hostTime.Truncate(time.Second))
+}
+
+// CorrectDrift spreads the measured clock drift linearly across the sample
+// times, assuming the iButton clock was accurate at the mission timestamp.
+// Samples logged after the status was read are left unchanged.
+func CorrectDrift(status *Status, samples []Sample) {
+
+	start := status.MissionTimestamp()
+	span := status.Time().Sub(start)
+	if span <= 0 {
+		return
+	}
+	drift := float64(status.Drift())
+
+	for i := range samples {
+		elapsed := samples[i].Time.Sub(start)
+		if elapsed < 0 || elapsed > span {
+			continue
+		}
+		samples[i].Time = samples[i].Time.Add(-time.Duration(drift * float64(elapsed) / float64(span)))
+	}
+}
@@ -0,0 +1,61 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"github.com/maxhille/go-ibutton/w1"
+	"testing"
+	"time"
+)
+
+func TestDrift(t *testing.T) {
+	for _, drift := range []float64{0, 100, -50} {
+		button, device, c := newButton(w1.DS1922L)
+		device.Drift = drift
+		start := c.now
+		startMission(t, button)
+		c.now = c.now.Add(30 * 24 * time.Hour)
+
+		status, err := button.Status()
+		if err != nil {
+			t.Fatalf("Status() = %v", err)
+		}
+		want := time.Duration(float64(30*24*time.Hour) * drift / 1e6)
+		if x := status.Drift(); x-want > time.Second || want-x > time.Second {
+			t.Errorf("%vppm: Drift() = %v, want %v", drift, x, want)
+		}
+		if x := status.HostTime(); !x.Equal(c.now) {
+			t.Errorf("%vppm: HostTime() = %v, want %v", drift, x, c.now)
+		}
+
+		samples, err := button.ReadLog()
+		if err != nil {
+			t.Fatalf("ReadLog() = %v", err)
+		}
+		w1.CorrectDrift(status, samples)
+
+		// the corrected times match the host times the samples were taken at
+		for _, i := range []int{0, len(samples) / 2, len(samples) - 1} {
+			rate := float64(10*time.Minute) / (1 + drift/1e6)
+			host := start.Add(time.Duration(rate * float64(i)))
+			if x := samples[i].Time.Sub(host); x > 2*time.Second || x < -2*time.Second {
+				t.Errorf("%vppm: sample %v at %v, want %v", drift, i, samples[i].Time, host)
+			}
+		}
+	}
+}
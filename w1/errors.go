@@ -0,0 +1,71 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"errors"
+	"fmt"
+)
+
+// errors returned by w1 operations, possibly wrapped with more details
+var (
+	ErrNoDevice          = errors.New("no iButton found")
+	ErrMultipleDevices   = errors.New("multiple iButtons found, select one by its ROM id")
+	ErrMissionRunning    = errors.New("mission in progress")
+	ErrUnsupportedDevice = errors.New("unsupported device")
+	ErrPasswordRequired  = errors.New("password required")
+)
+
+// CRCError is returned if a memory page fails its CRC check
+type CRCError struct {
+
+	// Address is the memory address of the page
+	Address uint16
+
+	// Page is the index of the page within the read, 0 for the initial page
+	Page int
+}
+
+func (e *CRCError) Error() string {
+
+	return fmt.Sprintf("crc check failed for page %d of the read (address %#04x)", e.Page, e.Address)
+}
+
+// denied true if the given page and CRC are all ones, which is what a
+// password protected iButton sends for an invalid password
+func denied(data []byte) bool {
+
+	for _, value := range data {
+		if value != 0xFF {
+			return false
+		}
+	}
+
+	return true
+}
+
+// supported fails with ErrUnsupportedDevice for models whose memory layout
+// is not known, rather than decoding garbage
+func (s *Status) supported() error {
+
+	if !devices[s.DeviceId()].supported {
+		return fmt.Errorf("%w (%v)", ErrUnsupportedDevice, s.Name())
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"errors"
+	"github.com/maxhille/go-ibutton/emulator"
+	"github.com/maxhille/go-ibutton/w1"
+	"testing"
+)
+
+func TestDeviceErrors(t *testing.T) {
+	first := emulator.NewDevice(w1.DS1922L, 0x01)
+	second := emulator.NewDevice(w1.DS1922L, 0x02)
+
+	tests := []struct {
+		bus *emulator.Bus
+		err error
+	}{
+		{emulator.NewBus(), w1.ErrNoDevice},
+		{emulator.NewBus(first), nil},
+		{emulator.NewBus(first, second), w1.ErrMultipleDevices},
+	}
+	for _, test := range tests {
+		button := new(w1.Button)
+		if err := button.OpenTransport(test.bus); !errors.Is(err, test.err) {
+			t.Errorf("OpenTransport() = %v, want %v", err, test.err)
+		}
+	}
+
+	// other families are not iButtons
+	if err := new(w1.Button).OpenByID("28-00000012ab34"); !errors.Is(err, w1.ErrUnsupportedDevice) {
+		t.Errorf("OpenByID(\"28-00000012ab34\") = %v, want ErrUnsupportedDevice", err)
+	}
+
+	// neither are unsupported models
+	if err := w1.DefaultMissionConfig.Validate(w1.DS2422); !errors.Is(err, w1.ErrUnsupportedDevice) {
+		t.Errorf("Validate(DS2422) = %v, want ErrUnsupportedDevice", err)
+	}
+	device := emulator.NewDevice(0x00, 0x03) // DS2422
+	button := w1.NewButton(emulator.NewBus(device), device.ROM())
+	if _, err := button.Status(); !errors.Is(err, w1.ErrUnsupportedDevice) {
+		t.Errorf("Status(DS2422) = %v, want ErrUnsupportedDevice", err)
+	}
+	if _, err := button.ReadLog(); !errors.Is(err, w1.ErrUnsupportedDevice) {
+		t.Errorf("ReadLog(DS2422) = %v, want ErrUnsupportedDevice", err)
+	}
+
+	// buttons must be opened and on the bus
+	if _, err := new(w1.Button).Status(); !errors.Is(err, w1.ErrNoDevice) {
+		t.Errorf("Status() before Open = %v, want ErrNoDevice", err)
+	}
+	if err := new(w1.Button).OpenByID("41-00000012ab34"); !errors.Is(err, w1.ErrNoDevice) {
+		t.Errorf("OpenByID(\"41-00000012ab34\") = %v, want ErrNoDevice", err)
+	}
+}
+
+func TestCRCError(t *testing.T) {
+	device := emulator.NewDevice(w1.DS1922L, 0x12ab34)
+	bus := &faultyBus{Transport: emulator.NewBus(device), corrupt: w1.READ_MEMORY}
+	button := w1.NewButton(bus, device.ROM())
+
+	_, err := button.Status()
+	var crcErr *w1.CRCError
+	if !errors.As(err, &crcErr) {
+		t.Fatalf("Status() = %v, want *CRCError", err)
+	}
+	if crcErr.Address != 0x0200 || crcErr.Page != 0 {
+		t.Errorf("CRCError = %+v, want page 0 at 0x0200", crcErr)
+	}
+}
+
+func TestMissionRunningErrors(t *testing.T) {
+	button, _, _ := newButton(w1.DS1922L)
+	startMission(t, button)
+
+	if err := button.StartMission(w1.DefaultMissionConfig); !errors.Is(err, w1.ErrMissionRunning) {
+		t.Errorf("StartMission() = %v, want ErrMissionRunning", err)
+	}
+	if err := button.SetHighAlarm(30, true); !errors.Is(err, w1.ErrMissionRunning) {
+		t.Errorf("SetHighAlarm() = %v, want ErrMissionRunning", err)
+	}
+}
@@ -0,0 +1,77 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+// Humidity represents a relative humidity in %RH
+type Humidity float32
+
+// REFERENCE_TEMPERATURE is the temperature humidities are compensated for
+// when a mission does not log temperatures
+const REFERENCE_TEMPERATURE = 25.0
+
+// decodeHumidity gives the uncorrected humidity encoded in the given byte slice
+func decodeHumidity(bytes []byte) (rh Humidity) {
+
+	// 12 bit ADC value
+	var adval float32
+	switch len(bytes) {
+	case 1:
+		adval = float32(bytes[0]) * 16
+	case 2:
+		adval = float32(uint16(bytes[0])<<8|uint16(bytes[1])) / 16
+	}
+
+	// sensor output voltage to humidity, from DS1923 data sheet
+	return Humidity((adval*5.02/4096 - 0.958) / 0.0307)
+}
+
+// compensateHumidity compensates the sensor's temperature dependence,
+// from DS1923 data sheet
+func compensateHumidity(rh Humidity, temp Temperature) Humidity {
+
+	return clampHumidity(rh / Humidity(1.0546-0.00216*float32(temp)))
+}
+
+// clampHumidity limits the given humidity to 0-100 %RH
+func clampHumidity(rh Humidity) Humidity {
+
+	switch {
+	case rh < 0:
+		return 0
+	case rh > 100:
+		return 100
+	}
+
+	return rh
+}
+
+// humidityCorrectionFactors returns the humidity correction factors for this device
+func (s *Status) humidityCorrectionFactors() (a Humidity, b Humidity, c Humidity) {
+
+	// get chip-hardcoded correction values
+	hr2 := decodeHumidity(s.bytes[0x48:0x4A])
+	hc2 := decodeHumidity(s.bytes[0x4A:0x4C])
+	hr3 := decodeHumidity(s.bytes[0x4C:0x4E])
+	hc3 := decodeHumidity(s.bytes[0x4E:0x50])
+	hr1 := decodeHumidity(s.bytes[0x50:0x52])
+	hc1 := decodeHumidity(s.bytes[0x52:0x54])
+
+	fa, fb, fc := quadratic(float32(hr1), float32(hc1-hr1), float32(hr2), float32(hc2-hr2), float32(hr3), float32(hc3-hr3))
+
+	return Humidity(fa), Humidity(fb), Humidity(fc)
+}
@@ -0,0 +1,131 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"github.com/maxhille/go-ibutton/w1"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestHumidityMission(t *testing.T) {
+	tests := []struct {
+		config    w1.MissionConfig
+		tolerance float64
+	}{
+		{w1.MissionConfig{SampleRate: time.Minute, LogTemperature: true, LogHumidity: true, HighResolution: true, HumidityHighResolution: true}, 0.1},
+		{w1.MissionConfig{SampleRate: time.Minute, LogTemperature: true, LogHumidity: true}, 1.0},
+		{w1.MissionConfig{SampleRate: time.Minute, LogHumidity: true, HumidityHighResolution: true}, 0.1},
+	}
+
+	for _, test := range tests {
+		button, device, c := newButton(w1.DS1923)
+		start := c.now
+		device.Temperature = func(t time.Time) float64 {
+			if test.config.LogTemperature {
+				return 5 + t.Sub(start).Minutes()
+			}
+			return w1.REFERENCE_TEMPERATURE
+		}
+		device.Humidity = func(t time.Time) float64 {
+			return 30 + t.Sub(start).Minutes()/2
+		}
+
+		startMissionConfig(t, button, test.config)
+		c.now = c.now.Add(40 * time.Minute)
+
+		status, err := button.Status()
+		if err != nil {
+			t.Fatalf("Status() = %v", err)
+		}
+		if status.TemperatureLogging() != test.config.LogTemperature || !status.HumidityLogging() {
+			t.Errorf("logging temperature %v, humidity %v, want %v, true",
+				status.TemperatureLogging(), status.HumidityLogging(), test.config.LogTemperature)
+		}
+
+		samples, err := button.ReadLog()
+		if err != nil {
+			t.Fatalf("ReadLog() = %v", err)
+		}
+		if len(samples) != 41 {
+			t.Fatalf("len(ReadLog()) = %v, want 41", len(samples))
+		}
+		for i, sample := range samples {
+			if test.config.LogTemperature && math.Abs(float64(sample.Temp)-float64(5+i)) > 0.5 {
+				t.Errorf("%+v: sample %v = %v°C, want %v°C", test.config, i, sample.Temp, 5+i)
+			}
+			if want := 30 + float64(i)/2; math.Abs(float64(sample.Humidity)-want) > test.tolerance {
+				t.Errorf("%+v: sample %v = %v%%RH, want %v%%RH", test.config, i, sample.Humidity, want)
+			}
+		}
+	}
+}
+
+func TestSaturatedHumidity(t *testing.T) {
+	config := w1.MissionConfig{SampleRate: time.Hour, LogHumidity: true, HumidityHighResolution: true}
+	button, device, c := newButton(w1.DS1923)
+	device.Temperature = func(time.Time) float64 { return w1.REFERENCE_TEMPERATURE }
+	device.Humidity = func(time.Time) float64 { return 95 }
+
+	startMissionConfig(t, button, config)
+	c.now = c.now.Add(11 * time.Hour)
+
+	// saturation drift is not corrected, the readings stay as logged
+	samples, err := button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+	if len(samples) != 12 {
+		t.Fatalf("len(ReadLog()) = %v, want 12", len(samples))
+	}
+	for i, sample := range samples {
+		if math.Abs(float64(sample.Humidity)-95) > 0.1 {
+			t.Errorf("sample %v = %v%%RH, want 95%%RH", i, sample.Humidity)
+		}
+	}
+}
+
+func TestCapacity(t *testing.T) {
+	tests := []struct {
+		config   w1.MissionConfig
+		capacity uint32
+	}{
+		{w1.MissionConfig{SampleRate: time.Minute, LogTemperature: true}, 8192},
+		{w1.MissionConfig{SampleRate: time.Minute, LogTemperature: true, HighResolution: true}, 4096},
+		{w1.MissionConfig{SampleRate: time.Minute, LogTemperature: true, LogHumidity: true}, 4096},
+		{w1.MissionConfig{SampleRate: time.Minute, LogTemperature: true, LogHumidity: true, HumidityHighResolution: true}, 2048},
+	}
+
+	for _, test := range tests {
+		button, _, _ := newButton(w1.DS1923)
+		if err := button.WriteScratchpad(test.config); err != nil {
+			t.Fatalf("WriteScratchpad() = %v", err)
+		}
+		if err := button.CopyScratchpad(); err != nil {
+			t.Fatalf("CopyScratchpad() = %v", err)
+		}
+		status, err := button.Status()
+		if err != nil {
+			t.Fatalf("Status() = %v", err)
+		}
+		if x := status.Capacity(); x != test.capacity {
+			t.Errorf("%+v: Capacity() = %v, want %v", test.config, x, test.capacity)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+// memory image file format: magic, version, ROM id, download time (unix
+// seconds, big endian) followed by the memory (0x0000-0x2FFF)
+const (
+	IMAGE_MAGIC   = "IBTN"
+	IMAGE_VERSION = 1
+	IMAGE_SIZE    = 0x3000
+)
+
+// memory areas saved in an image: general purpose memory, register pages
+// and calibration (0x0000-0x027F) and the log memory (0x1000-0x2FFF)
+var imageAreas = []struct {
+	address uint16
+	pages   int
+}{
+	{0x0000, 20},
+	{0x1000, 256},
+}
+
+// Image is a memory image of an iButton, which can be decoded offline
+type Image struct {
+
+	// ROM is the ROM id of the iButton
+	ROM ROM
+
+	// Time is the host time when the image was read
+	Time time.Time
+
+	// Memory holds the iButton memory (0x0000-0x2FFF), unused areas are 0xFF
+	Memory []byte
+
+	// Location is the time zone the iButton clock runs in, time.Local if
+	// nil. It is not saved in the image file.
+	Location *time.Location
+}
+
+// Dump reads the iButton's full memory image
+func (b *Button) Dump() (image *Image, err error) {
+
+	return b.DumpContext(context.Background())
+}
+
+// DumpContext is Dump, giving up between two pages once the context is done
+func (b *Button) DumpContext(ctx context.Context) (image *Image, err error) {
+
+	image = &Image{ROM: b.rom, Time: b.now(), Memory: bytes.Repeat([]byte{0xFF}, IMAGE_SIZE), Location: b.location}
+
+	for _, area := range imageAreas {
+		data, err := b.readMemoryContext(ctx, area.address, area.pages)
+		if err != nil {
+			return nil, err
+		}
+		copy(image.Memory[area.address:], data)
+	}
+
+	return
+}
+
+// ReadImage reads a memory image written by Image.WriteTo
+func ReadImage(r io.Reader) (image *Image, err error) {
+
+	var header struct {
+		Magic   [4]byte
+		Version byte
+		ROM     ROM
+		Time    int64
+	}
+	err = binary.Read(r, binary.BigEndian, &header)
+	if err != nil {
+		return
+	}
+	if string(header.Magic[:]) != IMAGE_MAGIC {
+		return nil, errors.New("not an iButton memory image")
+	}
+	if header.Version != IMAGE_VERSION {
+		return nil, errors.New("unsupported iButton memory image version")
+	}
+
+	image = &Image{ROM: header.ROM, Time: time.Unix(header.Time, 0), Memory: make([]byte, IMAGE_SIZE)}
+	_, err = io.ReadFull(r, image.Memory)
+	if err != nil {
+		return nil, err
+	}
+
+	return
+}
+
+// WriteTo writes the memory image to the given writer
+func (i *Image) WriteTo(w io.Writer) (n int64, err error) {
+
+	var buffer bytes.Buffer
+	buffer.WriteString(IMAGE_MAGIC)
+	buffer.WriteByte(IMAGE_VERSION)
+	buffer.Write(i.ROM[:])
+	binary.Write(&buffer, binary.BigEndian, i.Time.Unix())
+	buffer.Write(i.Memory)
+
+	return buffer.WriteTo(w)
+}
+
+// Status decodes the iButton status saved in the image
+func (i *Image) Status() (status *Status, err error) {
+
+	status = &Status{rom: i.ROM, location: i.Location, hostTime: i.Time}
+
+	status.bytes, err = i.readMemory(0x0200, 3)
+	if err != nil {
+		return
+	}
+
+	return status, status.supported()
+}
+
+// ReadLog decodes the log entries of the mission saved in the image
+func (i *Image) ReadLog() (samples []Sample, err error) {
+
+	status, err := i.Status()
+	if err != nil {
+		return
+	}
+
+	return i.reader(status).readAll()
+}
+
+// readMemory reads pages from the image
+func (i *Image) readMemory(address uint16, pages int) (data []byte, err error) {
+
+	end := int(address) + pages*32
+	if len(i.Memory) != IMAGE_SIZE || end > IMAGE_SIZE {
+		return nil, errors.New("read beyond the end of the memory image")
+	}
+
+	return append([]byte(nil), i.Memory[address:end]...), nil
+}
+
+// Decode decodes the status and the mission log saved in the given image
+func Decode(image *Image) (status *Status, samples []Sample, err error) {
+
+	status, err = image.Status()
+	if err != nil {
+		return
+	}
+
+	samples, err = image.reader(status).readAll()
+
+	return
+}
+
+// reader returns a reader for the samples of the mission saved in the image
+func (i *Image) reader(status *Status) (r *SampleReader) {
+
+	r = newSampleReader(status)
+	r.memory = i
+
+	return
+}
@@ -0,0 +1,82 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"bytes"
+	"github.com/maxhille/go-ibutton/w1"
+	"testing"
+	"time"
+)
+
+func TestImage(t *testing.T) {
+	button, device, c := newButton(w1.DS1923)
+	start := c.now
+	device.Temperature = func(t time.Time) float64 { return 10 + t.Sub(start).Hours() }
+	config := w1.MissionConfig{SampleRate: 10 * time.Minute, LogTemperature: true, LogHumidity: true, HighResolution: true}
+	startMissionConfig(t, button, config)
+	c.now = c.now.Add(24 * time.Hour)
+
+	live, err := button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+	image, err := button.Dump()
+	if err != nil {
+		t.Fatalf("Dump() = %v", err)
+	}
+
+	var file bytes.Buffer
+	if _, err := image.WriteTo(&file); err != nil {
+		t.Fatalf("WriteTo() = %v", err)
+	}
+	image, err = w1.ReadImage(&file)
+	if err != nil {
+		t.Fatalf("ReadImage() = %v", err)
+	}
+	if image.ROM != button.ROM() {
+		t.Errorf("ReadImage() ROM = %v, want %v", image.ROM, button.ROM())
+	}
+
+	status, samples, err := w1.Decode(image)
+	if err != nil {
+		t.Fatalf("Decode() = %v", err)
+	}
+	if status.ROM() != button.ROM() || status.Name() != "DS1923" || !status.MissionInProgress() {
+		t.Errorf("Decode() status = %v %v running %v", status.ROM(), status.Name(), status.MissionInProgress())
+	}
+	if len(samples) != len(live) {
+		t.Fatalf("Decode() decoded %v samples, want %v", len(samples), len(live))
+	}
+	for i := range live {
+		if samples[i] != live[i] {
+			t.Errorf("Decode() sample %v = %v, want %v", i, samples[i], live[i])
+		}
+	}
+}
+
+func TestReadImageInvalid(t *testing.T) {
+	if _, err := w1.ReadImage(bytes.NewReader([]byte("not an image at all, not an image at all"))); err == nil {
+		t.Errorf("ReadImage() = nil, want error")
+	}
+	var file bytes.Buffer
+	(&w1.Image{Memory: make([]byte, w1.IMAGE_SIZE)}).WriteTo(&file)
+	if _, err := w1.ReadImage(bytes.NewReader(file.Bytes()[:100])); err == nil {
+		t.Errorf("ReadImage() on truncated image = nil, want error")
+	}
+}
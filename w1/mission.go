@@ -0,0 +1,441 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+// device limits for mission parameters
+const (
+	MaxSampleRate = 16383 * time.Minute
+	MaxStartDelay = 0xFFFFFF * time.Minute
+)
+
+// MissionConfig holds the parameters of a mission
+type MissionConfig struct {
+
+	// SampleRate is the time between two samples. Whole minutes are
+	// programmed with EHSS=0, anything else in seconds with EHSS=1.
+	SampleRate time.Duration
+
+	// channels to log, humidity needs a DS1923
+	LogTemperature bool
+	LogHumidity    bool
+
+	// HighResolution logs 16 bit (0.0625°C) instead of 8 bit (0.5°C) temperatures
+	HighResolution bool
+
+	// HumidityHighResolution logs 16 bit instead of 8 bit humidities
+	HumidityHighResolution bool
+
+	// Rollover overwrites the oldest samples once the log memory is full
+	Rollover bool
+
+	// StartDelay is the time between mission start and the first sample, in whole minutes
+	StartDelay time.Duration
+
+	// StartAt schedules the first sample at the given time instead of after
+	// StartDelay. The delay is computed when the mission is programmed and
+	// rounded up to whole minutes.
+	StartAt time.Time
+
+	// temperature alarm thresholds and enables
+	LowAlarm         Temperature
+	HighAlarm        Temperature
+	LowAlarmEnabled  bool
+	HighAlarmEnabled bool
+
+	// StartUponAlarm (SUTA) holds off logging until a temperature alarm occurs
+	StartUponAlarm bool
+}
+
+// DefaultMissionConfig logs 16 bit temperatures every 10 minutes with alarms disabled
+var DefaultMissionConfig = MissionConfig{
+	SampleRate:     10 * time.Minute,
+	LogTemperature: true,
+	HighResolution: true,
+}
+
+// Validate checks the mission parameters against the limits of the given device
+func (c *MissionConfig) Validate(device deviceId) (err error) {
+
+	if !devices[device].supported {
+		return fmt.Errorf("%w (deviceId:%x)", ErrUnsupportedDevice, device)
+	}
+
+	if !c.LogTemperature && !c.LogHumidity {
+		return errors.New("mission logs neither temperature nor humidity")
+	}
+	if c.LogHumidity && device != DS1923 {
+		return fmt.Errorf("%v can not log humidity", devices[device].name)
+	}
+
+	_, _, err = c.sampleRate()
+	if err != nil {
+		return
+	}
+
+	if c.StartDelay < 0 || c.StartDelay > MaxStartDelay {
+		return fmt.Errorf("start delay %v out of range 0-%v", c.StartDelay, MaxStartDelay)
+	}
+	if c.StartDelay%time.Minute != 0 {
+		return fmt.Errorf("start delay %v is not a whole number of minutes", c.StartDelay)
+	}
+	if !c.StartAt.IsZero() && c.StartDelay != 0 {
+		return errors.New("mission has both a start delay and a start time")
+	}
+
+	if c.LowAlarmEnabled {
+		_, err = encodeThreshold(device, c.LowAlarm)
+		if err != nil {
+			return
+		}
+	}
+	if c.HighAlarmEnabled {
+		_, err = encodeThreshold(device, c.HighAlarm)
+		if err != nil {
+			return
+		}
+	}
+	if c.LowAlarmEnabled && c.HighAlarmEnabled && c.LowAlarm >= c.HighAlarm {
+		return fmt.Errorf("low alarm %v°C not below high alarm %v°C", c.LowAlarm, c.HighAlarm)
+	}
+
+	if c.StartUponAlarm && !c.LowAlarmEnabled && !c.HighAlarmEnabled {
+		return errors.New("start upon temperature alarm needs an enabled alarm")
+	}
+
+	return
+}
+
+// startDelay returns the start delay, counting from now for missions with a start time
+func (c *MissionConfig) startDelay(now time.Time) (delay time.Duration, err error) {
+
+	if c.StartAt.IsZero() {
+		return c.StartDelay, nil
+	}
+
+	delay = c.StartAt.Sub(now)
+	if delay < 0 {
+		return 0, fmt.Errorf("start time %v is in the past", c.StartAt)
+	}
+	delay = (delay + time.Minute - 1) / time.Minute * time.Minute
+	if delay > MaxStartDelay {
+		return 0, fmt.Errorf("start time %v is more than %v ahead", c.StartAt, MaxStartDelay)
+	}
+
+	return
+}
+
+// sampleRate returns the sample rate register value and whether it counts seconds (EHSS)
+func (c *MissionConfig) sampleRate() (rate uint16, seconds bool, err error) {
+
+	switch {
+	case c.SampleRate < time.Second || c.SampleRate > MaxSampleRate:
+		err = fmt.Errorf("sample rate %v out of range 1s-%v", c.SampleRate, MaxSampleRate)
+	case c.SampleRate%time.Minute == 0:
+		rate = uint16(c.SampleRate / time.Minute)
+	case c.SampleRate%time.Second == 0 && c.SampleRate <= 16383*time.Second:
+		rate = uint16(c.SampleRate / time.Second)
+		seconds = true
+	default:
+		err = fmt.Errorf("sample rate %v is neither whole minutes nor whole seconds up to 16383s", c.SampleRate)
+	}
+
+	return
+}
+
+// encodeThreshold encodes the given alarm threshold for the given device
+func encodeThreshold(device deviceId, temp Temperature) (value byte, err error) {
+
+	if temp < devices[device].min || temp > devices[device].max {
+		return 0, fmt.Errorf("alarm threshold %v°C out of the %v range %v°C-%v°C",
+			temp, devices[device].name, devices[device].min, devices[device].max)
+	}
+
+	raw := math.Floor(float64(temp-Temperature(devices[device].offset))*2 + 0.5)
+
+	return byte(raw), nil
+}
+
+// registers encodes the mission parameters into the register page (0x0200-0x021F)
+// of the given device, setting the clock to the given time
+func (c *MissionConfig) registers(device deviceId, now time.Time, hour12 bool) (data []byte, err error) {
+
+	err = c.Validate(device)
+	if err != nil {
+		return
+	}
+	startDelay, err := c.startDelay(now)
+	if err != nil {
+		return
+	}
+
+	data = make([]byte, 32)
+
+	// time and date, keeping the clock's hour mode
+	copy(data[0x00:], encodeRTC(now, hour12))
+
+	// sample rate
+	rate, seconds, _ := c.sampleRate()
+	data[0x06] = byte(rate)
+	data[0x07] = byte(rate >> 8)
+
+	// alarm thresholds, disabled ones are kept in range
+	data[0x08], err = encodeThreshold(device, c.LowAlarm)
+	if err != nil {
+		data[0x08], err = 0x00, nil
+	}
+	data[0x09], err = encodeThreshold(device, c.HighAlarm)
+	if err != nil {
+		data[0x09], err = 0xFF, nil
+	}
+
+	// alarm control
+	if c.LowAlarmEnabled {
+		data[0x10] |= 0x01 << 0
+	}
+	if c.HighAlarmEnabled {
+		data[0x10] |= 0x01 << 1
+	}
+
+	// "Disabled" - registers is R/W but should be 0xfc
+	data[0x11] = 0xFC
+
+	// EOSC=1 (oscillator running), EHSS
+	data[0x12] = 0x01
+	if seconds {
+		data[0x12] |= 0x01 << 1
+	}
+
+	// mission control: channels, resolutions, rollover, SUTA
+	data[0x13] = 0xC0
+	if c.LogTemperature {
+		data[0x13] |= 0x01 << 0
+	}
+	if c.LogHumidity {
+		data[0x13] |= 0x01 << 1
+	}
+	if c.HighResolution {
+		data[0x13] |= 0x01 << 2
+	}
+	if c.HumidityHighResolution {
+		data[0x13] |= 0x01 << 3
+	}
+	if c.Rollover {
+		data[0x13] |= 0x01 << 4
+	}
+	if c.StartUponAlarm {
+		data[0x13] |= 0x01 << 5
+	}
+
+	// mission start delay in minutes
+	delay := uint32(startDelay / time.Minute)
+	data[0x16] = byte(delay)
+	data[0x17] = byte(delay >> 8)
+	data[0x18] = byte(delay >> 16)
+
+	// "write through the end of the scratchpad"
+	for i := 0x19; i < 0x20; i++ {
+		data[i] = 0xFF
+	}
+
+	return
+}
+
+// MissionStep is a step of the mission start workflow
+type MissionStep int
+
+// mission start steps, in workflow order
+const (
+	StepCheckIdle MissionStep = iota
+	StepWriteScratchpad
+	StepVerifyScratchpad
+	StepCopyScratchpad
+	StepVerifyRegisters
+	StepClearMemory
+	StepVerifyMemoryCleared
+	StepStartMission
+	StepVerifyMission
+)
+
+// missionStepNames in step order
+var missionStepNames = []string{
+	"check idle",
+	"write scratchpad",
+	"verify scratchpad",
+	"copy scratchpad",
+	"verify registers",
+	"clear memory",
+	"verify memory cleared",
+	"start mission",
+	"verify mission",
+}
+
+// String the name of the step
+func (s MissionStep) String() string {
+
+	if s < 0 || int(s) >= len(missionStepNames) {
+		return fmt.Sprintf("step %d", int(s))
+	}
+
+	return missionStepNames[s]
+}
+
+// StartError describes the mission start step that failed
+type StartError struct {
+	Step MissionStep
+	Err  error
+}
+
+func (e *StartError) Error() string {
+
+	return fmt.Sprintf("mission start failed at %v (%v)", e.Step, e.Err)
+}
+
+// Unwrap the error of the failed step
+func (e *StartError) Unwrap() error {
+
+	return e.Err
+}
+
+// registers written by the mission setup which read back unchanged (the RTC
+// runs on and the alarm status, latest conversion and timestamp registers
+// are read-only)
+var missionRegisters = [][2]int{{0x06, 0x0C}, {0x10, 0x14}, {0x16, 0x19}}
+
+// StartMission programs and starts a mission with the given parameters. Each
+// step is verified: the scratchpad byte for byte before copying, the register
+// page after copying and the cleared memory (MEMCLR) before starting. Errors
+// are *StartError values naming the failed step.
+func (b *Button) StartMission(config MissionConfig) (err error) {
+
+	return b.StartMissionContext(context.Background(), config)
+}
+
+// StartMissionContext is StartMission, giving up before the next step once
+// the context is done
+func (b *Button) StartMissionContext(ctx context.Context, config MissionConfig) (err error) {
+
+	fail := func(step MissionStep, err error) error {
+		return &StartError{Step: step, Err: err}
+	}
+
+	// registers are write protected during a mission
+	status, err := b.StatusContext(ctx)
+	if err != nil {
+		return fail(StepCheckIdle, err)
+	}
+	if status.MissionInProgress() {
+		return fail(StepCheckIdle, ErrMissionRunning)
+	}
+
+	now := b.now().In(status.Location())
+	registers, err := config.registers(status.DeviceId(), now, status.hour12())
+	if err != nil {
+		return fail(StepWriteScratchpad, err)
+	}
+	cmd := append([]byte{WRITE_SCRATCHPAD, 0x00, 0x02}, registers...)
+	err = ctx.Err()
+	if err != nil {
+		return fail(StepWriteScratchpad, err)
+	}
+	err = b.command(cmd)
+	if err != nil {
+		return fail(StepWriteScratchpad, err)
+	}
+
+	// target address, ending offset and every data byte
+	err = ctx.Err()
+	if err != nil {
+		return fail(StepVerifyScratchpad, err)
+	}
+	scratchpad, err := b.ReadScratchpad()
+	if err != nil {
+		return fail(StepVerifyScratchpad, err)
+	}
+	if scratchpad[0] != 0x00 || scratchpad[1] != 0x02 || scratchpad[2] != 0x1F {
+		return fail(StepVerifyScratchpad, fmt.Errorf("target %02x%02x, ending offset %#x, want 0200, 0x1f", scratchpad[1], scratchpad[0], scratchpad[2]))
+	}
+	for i, value := range registers {
+		if scratchpad[3+i] != value {
+			return fail(StepVerifyScratchpad, fmt.Errorf("register %#x is %#x, want %#x", 0x0200+i, scratchpad[3+i], value))
+		}
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return fail(StepCopyScratchpad, err)
+	}
+	err = b.CopyScratchpad()
+	if err != nil {
+		return fail(StepCopyScratchpad, err)
+	}
+
+	// the copy succeeded if the writable registers read back as written and
+	// the clock runs from the time set
+	page, err := b.readMemoryContext(ctx, 0x0200, 1)
+	if err != nil {
+		return fail(StepVerifyRegisters, err)
+	}
+	for _, area := range missionRegisters {
+		for i := area[0]; i < area[1]; i++ {
+			if page[i] != registers[i] {
+				return fail(StepVerifyRegisters, fmt.Errorf("register %#x is %#x, want %#x", 0x0200+i, page[i], registers[i]))
+			}
+		}
+	}
+	if clock := decodeRTC(page[0x00:0x06], now.Location()); clock.Before(now.Truncate(time.Second)) || clock.Sub(now) > time.Minute {
+		return fail(StepVerifyRegisters, fmt.Errorf("clock reads %v, set to %v", clock, now))
+	}
+
+	err = b.ClearMemoryContext(ctx)
+	if err != nil {
+		return fail(StepClearMemory, err)
+	}
+	status, err = b.StatusContext(ctx)
+	if err != nil {
+		return fail(StepVerifyMemoryCleared, err)
+	}
+	if !status.MemoryCleared() {
+		return fail(StepVerifyMemoryCleared, errors.New("memory not cleared"))
+	}
+
+	err = ctx.Err()
+	if err != nil {
+		return fail(StepStartMission, err)
+	}
+	err = b.startMission()
+	if err != nil {
+		return fail(StepStartMission, err)
+	}
+	status, err = b.StatusContext(ctx)
+	if err != nil {
+		return fail(StepVerifyMission, err)
+	}
+	if !status.MissionInProgress() {
+		return fail(StepVerifyMission, errors.New("mission not running"))
+	}
+
+	return
+}
@@ -0,0 +1,294 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"errors"
+	"github.com/maxhille/go-ibutton/emulator"
+	"github.com/maxhille/go-ibutton/w1"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestMissionConfigValidate(t *testing.T) {
+	tests := []struct {
+		config w1.MissionConfig
+		valid  bool
+	}{
+		{w1.DefaultMissionConfig, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Second}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: 16383 * time.Second}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: 16384 * time.Second}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: w1.MaxSampleRate}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: w1.MaxSampleRate + time.Minute}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: 1500 * time.Millisecond}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: 0}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, StartDelay: 90 * time.Minute}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, StartDelay: 90 * time.Second}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, StartDelay: w1.MaxStartDelay + time.Minute}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, StartAt: time.Now()}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, StartAt: time.Now(), StartDelay: time.Hour}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, LowAlarm: -40, LowAlarmEnabled: true}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, LowAlarm: -40.5, LowAlarmEnabled: true}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, LowAlarm: -42}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, HighAlarm: 85, HighAlarmEnabled: true}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, HighAlarm: 85.5, HighAlarmEnabled: true}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, LowAlarm: 10, LowAlarmEnabled: true, HighAlarm: 5, HighAlarmEnabled: true}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, StartUponAlarm: true}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, StartUponAlarm: true, HighAlarm: 30, HighAlarmEnabled: true}, true},
+		{w1.MissionConfig{SampleRate: time.Minute}, false},
+		{w1.MissionConfig{LogHumidity: true, SampleRate: time.Minute}, false},
+	}
+	for _, test := range tests {
+		err := test.config.Validate(w1.DS1922L)
+		if (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", test.config, err, test.valid)
+		}
+	}
+	if err := w1.DefaultMissionConfig.Validate(w1.DS2422); err == nil {
+		t.Errorf("Validate(DS2422) = nil, want unsupported device error")
+	}
+	humidity := w1.MissionConfig{LogHumidity: true, SampleRate: time.Minute}
+	if err := humidity.Validate(w1.DS1923); err != nil {
+		t.Errorf("Validate(%+v) on DS1923 = %v, want nil", humidity, err)
+	}
+}
+
+func TestWriteScratchpadConfig(t *testing.T) {
+	button, _, c := newButton(w1.DS1922L)
+	config := w1.MissionConfig{LogTemperature: true, SampleRate: 30 * time.Second, StartDelay: 5 * time.Minute}
+	startMissionConfig(t, button, config)
+
+	// the first sample is taken after the delay
+	c.now = c.now.Add(5*time.Minute + 45*time.Second)
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if x := status.SampleRate(); x != 30*time.Second {
+		t.Errorf("SampleRate() = %v, want 30s", x)
+	}
+	if status.HighResolution() {
+		t.Errorf("HighResolution() = true, want false")
+	}
+	if x := status.SampleCount(); x != 2 {
+		t.Errorf("SampleCount() = %v, want 2", x)
+	}
+	samples, err := button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+	for i, sample := range samples {
+		if sample.Temp != 20 {
+			t.Errorf("sample %v = %v°C, want 20°C", i, sample.Temp)
+		}
+	}
+}
+
+func TestStartAt(t *testing.T) {
+	button, _, c := newButton(w1.DS1922L)
+	at := c.now.Add(2*time.Hour + 30*time.Minute + 10*time.Second)
+	config := w1.MissionConfig{LogTemperature: true, SampleRate: time.Minute, StartAt: at}
+	startMissionConfig(t, button, config)
+
+	// the delay is rounded up to whole minutes
+	c.now = c.now.Add(time.Hour)
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if !status.MissionInProgress() || !status.WaitingToStart() {
+		t.Errorf("MissionInProgress(), WaitingToStart() = %v, %v, want true, true", status.MissionInProgress(), status.WaitingToStart())
+	}
+	if x := status.StartDelay(); x != 91*time.Minute {
+		t.Errorf("StartDelay() = %v, want 1h31m", x)
+	}
+	if x := status.SampleCount(); x != 0 {
+		t.Errorf("SampleCount() = %v, want 0", x)
+	}
+
+	c.now = c.now.Add(91 * time.Minute)
+	status, err = button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if status.WaitingToStart() || status.StartDelay() != 0 {
+		t.Errorf("WaitingToStart(), StartDelay() = %v, %v, want false, 0", status.WaitingToStart(), status.StartDelay())
+	}
+	if x, want := status.MissionTimestamp(), at.Truncate(time.Minute).Add(time.Minute); !x.Equal(want) {
+		t.Errorf("MissionTimestamp() = %v, want %v", x, want)
+	}
+
+	// start times in the past are rejected
+	config.StartAt = c.now.Add(-time.Minute)
+	if err := button.StopMission(); err != nil {
+		t.Fatalf("StopMission() = %v", err)
+	}
+	if err := button.ClearMemory(); err != nil {
+		t.Fatalf("ClearMemory() = %v", err)
+	}
+	if err := button.WriteScratchpad(config); err == nil {
+		t.Errorf("WriteScratchpad() with past start time = nil, want error")
+	}
+}
+
+func TestDS1922E(t *testing.T) {
+	tests := []struct {
+		config w1.MissionConfig
+		valid  bool
+	}{
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Second, HighAlarm: 121, HighAlarmEnabled: true}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Second, HighAlarm: 140, HighAlarmEnabled: true}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Second, HighAlarm: 141, HighAlarmEnabled: true}, false},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Second, LowAlarm: 15, LowAlarmEnabled: true}, true},
+		{w1.MissionConfig{LogTemperature: true, SampleRate: time.Second, LowAlarm: 10, LowAlarmEnabled: true}, false},
+	}
+	for _, test := range tests {
+		err := test.config.Validate(w1.DS1922E)
+		if (err == nil) != test.valid {
+			t.Errorf("Validate(%+v) = %v, want valid %v", test.config, err, test.valid)
+		}
+	}
+
+	button, device, c := newButton(w1.DS1922E)
+	device.Temperature = func(time.Time) float64 { return 121.1 }
+	config := w1.DefaultMissionConfig
+	config.SampleRate = time.Second
+	startMissionConfig(t, button, config)
+	c.now = c.now.Add(9 * time.Second)
+
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if x := status.Name(); x != "DS1922E" {
+		t.Errorf("Name() = %v, want DS1922E", x)
+	}
+	if min, max := status.TemperatureRange(); min != 15 || max != 140 {
+		t.Errorf("TemperatureRange() = %v, %v, want 15, 140", min, max)
+	}
+	samples, err := button.ReadLog()
+	if err != nil {
+		t.Fatalf("ReadLog() = %v", err)
+	}
+	if len(samples) != 10 {
+		t.Fatalf("len(ReadLog()) = %v, want 10", len(samples))
+	}
+	for i, sample := range samples {
+		if math.Abs(float64(sample.Temp)-121.1) > 0.0625 {
+			t.Errorf("sample %v = %v°C, want 121.1°C", i, sample.Temp)
+		}
+	}
+
+	// raw bytes per data sheet, T = TRH/2 + 14 + TRL/512
+	image, err := button.Dump()
+	if err != nil {
+		t.Fatalf("Dump() = %v", err)
+	}
+	if x := image.Memory[0x1000]; x != 214 {
+		t.Errorf("first sample TRH = %v, want 214 (121°C)", x)
+	}
+}
+
+func TestDS1922EAlarmThreshold(t *testing.T) {
+	button, _, _ := newButton(w1.DS1922E)
+	if err := button.SetHighAlarm(121, true); err != nil {
+		t.Fatalf("SetHighAlarm() = %v", err)
+	}
+	image, err := button.Dump()
+	if err != nil {
+		t.Fatalf("Dump() = %v", err)
+	}
+
+	// threshold byte per data sheet, T = byte/2 + 14
+	if x := image.Memory[0x0209]; x != 214 {
+		t.Errorf("high alarm threshold = %v, want 214 (121°C)", x)
+	}
+}
+
+// faultyBus drops or corrupts commands on the way to the emulated device
+type faultyBus struct {
+	w1.Transport
+	drop    byte
+	corrupt byte
+	last    byte
+}
+
+func (b *faultyBus) Write(data []byte) error {
+	b.last = data[0]
+	if data[0] == b.drop {
+		return nil
+	}
+	return b.Transport.Write(data)
+}
+
+func (b *faultyBus) Read(data []byte) error {
+	err := b.Transport.Read(data)
+	if b.last == b.corrupt {
+		data[len(data)-1] ^= 0x01
+	}
+	return err
+}
+
+func TestStartMissionErrors(t *testing.T) {
+	tests := []struct {
+		drop    byte
+		corrupt byte
+		config  w1.MissionConfig
+		step    w1.MissionStep
+	}{
+		{0, 0, w1.MissionConfig{SampleRate: time.Minute}, w1.StepWriteScratchpad},
+		{w1.WRITE_SCRATCHPAD, 0, w1.DefaultMissionConfig, w1.StepVerifyScratchpad},
+		{0, w1.READ_SCRATCHPAD, w1.DefaultMissionConfig, w1.StepVerifyScratchpad},
+		{w1.COPY_SCRATCHPAD, 0, w1.MissionConfig{LogTemperature: true, SampleRate: 30 * time.Second}, w1.StepVerifyRegisters},
+		{w1.CLEAR_MEMORY, 0, w1.DefaultMissionConfig, w1.StepVerifyMemoryCleared},
+		{w1.START_MISSION, 0, w1.DefaultMissionConfig, w1.StepVerifyMission},
+	}
+
+	for _, test := range tests {
+		c := &clock{time.Date(2013, 4, 1, 15, 30, 0, 0, time.Local)}
+		device := emulator.NewDevice(w1.DS1922L, 0x12ab34)
+		device.Now = c.Now
+		bus := &faultyBus{Transport: emulator.NewBus(device)}
+		button := w1.NewButton(bus, device.ROM())
+		button.Now = c.Now
+
+		// a finished mission leaves the memory not cleared
+		startMission(t, button)
+		if err := button.StopMission(); err != nil {
+			t.Fatalf("StopMission() = %v", err)
+		}
+
+		bus.drop, bus.corrupt = test.drop, test.corrupt
+		err := button.StartMission(test.config)
+		var startErr *w1.StartError
+		if !errors.As(err, &startErr) || startErr.Step != test.step {
+			t.Errorf("drop %#x, corrupt %#x: StartMission() = %v, want %v error", test.drop, test.corrupt, err, test.step)
+		}
+	}
+
+	// no changes during a mission
+	button, _, _ := newButton(w1.DS1922L)
+	startMission(t, button)
+	err := button.StartMission(w1.DefaultMissionConfig)
+	var startErr *w1.StartError
+	if !errors.As(err, &startErr) || startErr.Step != w1.StepCheckIdle {
+		t.Errorf("StartMission() during a mission = %v, want %v error", err, w1.StepCheckIdle)
+	}
+}
@@ -0,0 +1,127 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"fmt"
+)
+
+// password control register value enabling password protection
+const PASSWORDS_ENABLED = 0xAA
+
+// Password is a DS1922/DS1923 read access or full access password. Once
+// passwords are enabled, READ_MEMORY needs either password and CLEAR_MEMORY,
+// START_MISSION, STOP_MISSION and COPY_SCRATCHPAD need the full access password.
+type Password [8]byte
+
+// NewPassword returns the password made of the given string's bytes,
+// padded with zeros. Passwords are at most 8 bytes long and must not be
+// empty: the all zero password is what commands carry without a password.
+func NewPassword(s string) (password Password, err error) {
+
+	if len(s) > len(password) {
+		return password, fmt.Errorf("password longer than %v bytes", len(password))
+	}
+
+	copy(password[:], s)
+	if password == (Password{}) {
+		return password, fmt.Errorf("password is empty")
+	}
+
+	return
+}
+
+// OpenWithPassword opens this iButton's 1-Wire session, sending the given
+// password with every command
+func (b *Button) OpenWithPassword(password Password) (err error) {
+
+	b.password = password
+
+	return b.Open()
+}
+
+// UsePassword sends the given password with every following command
+func (b *Button) UsePassword(password Password) {
+
+	b.password = password
+}
+
+// SetPasswords programs the read access and full access passwords without
+// changing whether they are enabled. The button uses the new full access
+// password from then on. Empty passwords would not protect anything and are
+// rejected.
+func (b *Button) SetPasswords(read Password, full Password) (err error) {
+
+	if read == (Password{}) || full == (Password{}) {
+		return fmt.Errorf("read access and full access password must not be empty")
+	}
+
+	_, err = b.idleStatus()
+	if err != nil {
+		return
+	}
+
+	data := make([]byte, 0, 16)
+	data = append(data, read[:]...)
+	data = append(data, full[:]...)
+	err = b.writeRegisters(0x0228, data)
+	if err != nil {
+		return
+	}
+
+	b.password = full
+
+	return
+}
+
+// EnablePasswords turns on password protection
+func (b *Button) EnablePasswords() (err error) {
+
+	_, err = b.idleStatus()
+	if err != nil {
+		return
+	}
+
+	return b.writeRegisters(0x0227, []byte{PASSWORDS_ENABLED})
+}
+
+// DisablePasswords turns off password protection
+func (b *Button) DisablePasswords() (err error) {
+
+	_, err = b.idleStatus()
+	if err != nil {
+		return
+	}
+
+	return b.writeRegisters(0x0227, []byte{0x00})
+}
+
+// idleStatus returns the iButton status, failing if a mission is in
+// progress, which write protects the registers
+func (b *Button) idleStatus() (status *Status, err error) {
+
+	status, err = b.Status()
+	if err != nil {
+		return
+	}
+	if status.MissionInProgress() {
+		return nil, fmt.Errorf("registers can not be changed (%w)", ErrMissionRunning)
+	}
+
+	return
+}
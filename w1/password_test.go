@@ -0,0 +1,107 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"errors"
+	"github.com/maxhille/go-ibutton/emulator"
+	"github.com/maxhille/go-ibutton/w1"
+	"testing"
+)
+
+func TestNewPassword(t *testing.T) {
+	password, err := w1.NewPassword("secret")
+	if err != nil {
+		t.Fatalf("NewPassword() = %v", err)
+	}
+	if x := (w1.Password{'s', 'e', 'c', 'r', 'e', 't', 0, 0}); password != x {
+		t.Errorf("NewPassword(\"secret\") = %v, want %v", password, x)
+	}
+	if _, err := w1.NewPassword("too long!"); err == nil {
+		t.Errorf("NewPassword(\"too long!\") = nil, want error")
+	}
+
+	// empty passwords leave the memory readable by anyone
+	for _, s := range []string{"", "\x00\x00"} {
+		if _, err := w1.NewPassword(s); err == nil {
+			t.Errorf("NewPassword(%q) = nil, want error", s)
+		}
+	}
+}
+
+func TestPasswords(t *testing.T) {
+	owner, device, _ := newButton(w1.DS1922L)
+	read, _ := w1.NewPassword("reader")
+	full, _ := w1.NewPassword("owner")
+
+	if err := owner.SetPasswords(w1.Password{}, full); err == nil {
+		t.Errorf("SetPasswords() without read access password = nil, want error")
+	}
+	if err := owner.SetPasswords(read, full); err != nil {
+		t.Fatalf("SetPasswords() = %v", err)
+	}
+	if err := owner.EnablePasswords(); err != nil {
+		t.Fatalf("EnablePasswords() = %v", err)
+	}
+	startMission(t, owner)
+
+	bus := emulator.NewBus(device)
+
+	// no password, no access
+	stranger := w1.NewButton(bus, device.ROM())
+	if _, err := stranger.Status(); !errors.Is(err, w1.ErrPasswordRequired) {
+		t.Errorf("Status() without password = %v, want ErrPasswordRequired", err)
+	}
+
+	// read access password reads, but can not stop the mission
+	reader := w1.NewButton(bus, device.ROM())
+	reader.UsePassword(read)
+	status, err := reader.Status()
+	if err != nil {
+		t.Fatalf("Status() with read access password = %v", err)
+	}
+	if !status.PasswordsEnabled() {
+		t.Errorf("PasswordsEnabled() = false, want true")
+	}
+	if err := reader.StopMission(); err != nil {
+		t.Fatalf("StopMission() = %v", err)
+	}
+	status, err = reader.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if !status.MissionInProgress() {
+		t.Errorf("StopMission() with read access password stopped the mission")
+	}
+
+	// full access password does everything
+	if err := owner.StopMission(); err != nil {
+		t.Fatalf("StopMission() = %v", err)
+	}
+	if err := owner.DisablePasswords(); err != nil {
+		t.Fatalf("DisablePasswords() = %v", err)
+	}
+	status, err = stranger.Status()
+	if err != nil {
+		t.Fatalf("Status() after DisablePasswords() = %v", err)
+	}
+	if status.MissionInProgress() || status.PasswordsEnabled() {
+		t.Errorf("mission running %v, passwords enabled %v, want both false",
+			status.MissionInProgress(), status.PasswordsEnabled())
+	}
+}
@@ -0,0 +1,202 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"context"
+	"io"
+)
+
+// READER_CHUNK is the default number of log pages a SampleReader reads at once
+const READER_CHUNK = 8
+
+// SampleReader streams the samples of the current mission in chronological
+// order, reading the log memory in chunks of pages as the samples are needed
+type SampleReader struct {
+
+	// Chunk is the number of pages read with one memory read command,
+	// READER_CHUNK if 0. Smaller chunks give samples earlier, larger ones
+	// download faster.
+	Chunk int
+
+	// Progress is called after every log page read with the count of log
+	// pages read so far and the total count of log pages of the mission
+	Progress func(read, total int)
+
+	memory   memory
+	status   *Status
+	decoder  *logDecoder
+	first    uint32
+	count    uint32
+	index    uint32
+	channels []*logChannel
+	read     int
+	total    int
+}
+
+// logChannel caches the pages of one logged channel
+type logChannel struct {
+	address     uint16
+	sampleBytes uint32
+	pages       int
+	loaded      map[int][]byte
+}
+
+// NewSampleReader returns a reader for the samples of the current mission
+func (b *Button) NewSampleReader(ctx context.Context) (r *SampleReader, err error) {
+
+	status, err := b.StatusContext(ctx)
+	if err != nil {
+		return
+	}
+
+	r = newSampleReader(status)
+	r.memory = contextMemory{ctx, b, r.page}
+
+	return
+}
+
+// newSampleReader returns a reader for the samples of the mission described
+// by the given status, without a memory to read them from
+func newSampleReader(status *Status) (r *SampleReader) {
+
+	r = &SampleReader{status: status, decoder: newLogDecoder(status)}
+	r.first, r.count = status.logWindow()
+
+	// a rolled over log uses every page of the channels' memory
+	span := r.count
+	if r.first > 0 {
+		span = status.Capacity()
+	}
+	for _, humidity := range []bool{false, true} {
+		logged := status.TemperatureLogging()
+		if humidity {
+			logged = status.HumidityLogging()
+		}
+		if !logged || r.count == 0 {
+			r.channels = append(r.channels, nil)
+			continue
+		}
+		channel := &logChannel{
+			address:     status.logAddress(humidity),
+			sampleBytes: status.sampleBytes(humidity),
+			loaded:      map[int][]byte{},
+		}
+		channel.pages = int((span*channel.sampleBytes + 31) / 32)
+		r.total += channel.pages
+		r.channels = append(r.channels, channel)
+	}
+
+	return
+}
+
+// Status the status of the mission being read
+func (r *SampleReader) Status() *Status {
+
+	return r.status
+}
+
+// Len the count of samples not read yet
+func (r *SampleReader) Len() int {
+
+	return int(r.count - r.index)
+}
+
+// Next returns the next sample, io.EOF after the last one
+func (r *SampleReader) Next() (sample Sample, err error) {
+
+	if r.index >= r.count {
+		return sample, io.EOF
+	}
+
+	position := (r.first + r.index) % r.status.Capacity()
+	raw := make([][]byte, len(r.channels))
+	for i, channel := range r.channels {
+		if channel == nil {
+			continue
+		}
+		raw[i], err = r.bytes(channel, position)
+		if err != nil {
+			return
+		}
+	}
+
+	sample = r.decoder.decode(r.index, raw[0], raw[1])
+	r.index++
+
+	return
+}
+
+// bytes the given channel's bytes of the sample at the given log position,
+// reading the chunk of pages starting with its page if needed
+func (r *SampleReader) bytes(channel *logChannel, position uint32) (data []byte, err error) {
+
+	offset := position * channel.sampleBytes
+	page := int(offset / 32)
+
+	if channel.loaded[page] == nil {
+		chunk := r.Chunk
+		if chunk <= 0 {
+			chunk = READER_CHUNK
+		}
+		pages := 0
+		for page+pages < channel.pages && pages < chunk && channel.loaded[page+pages] == nil {
+			pages++
+		}
+
+		var memory []byte
+		memory, err = r.memory.readMemory(channel.address+uint16(page*32), pages)
+		if err != nil {
+			return
+		}
+		for i := 0; i < pages; i++ {
+			channel.loaded[page+i] = memory[i*32 : (i+1)*32]
+		}
+	}
+
+	start := offset % 32
+
+	return channel.loaded[page][start : start+channel.sampleBytes], nil
+}
+
+// page counts a log page read and reports the progress
+func (r *SampleReader) page() {
+
+	r.read++
+	if r.Progress != nil {
+		r.Progress(r.read, r.total)
+	}
+}
+
+// readAll returns all samples not read yet, reading each channel's log with
+// a single memory read unless it rolled over
+func (r *SampleReader) readAll() (samples []Sample, err error) {
+
+	r.Chunk = r.total
+	samples = make([]Sample, 0, r.Len())
+	for {
+		sample, err := r.Next()
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		samples = append(samples, sample)
+	}
+}
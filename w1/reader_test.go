@@ -0,0 +1,96 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"context"
+	"github.com/maxhille/go-ibutton/w1"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestSampleReader(t *testing.T) {
+	tests := []struct {
+		model   byte
+		config  w1.MissionConfig
+		elapsed time.Duration
+		chunk   int
+		pages   int
+	}{
+		{w1.DS1922L, w1.MissionConfig{SampleRate: time.Second, LogTemperature: true, HighResolution: true}, time.Hour, 0, 226},
+		{w1.DS1922L, w1.MissionConfig{SampleRate: time.Second, LogTemperature: true, Rollover: true}, 10000 * time.Second, 1, 256},
+		{w1.DS1923, w1.MissionConfig{SampleRate: time.Second, LogTemperature: true, LogHumidity: true, Rollover: true}, 5000 * time.Second, 5, 256},
+		{w1.DS1923, w1.MissionConfig{SampleRate: time.Minute, LogHumidity: true}, 0, 0, 1},
+	}
+
+	for _, test := range tests {
+		button, device, c := newButton(test.model)
+		start := c.now
+		device.Temperature = func(t time.Time) float64 {
+			return float64(int(t.Sub(start).Seconds())%120) / 4
+		}
+		device.Humidity = func(t time.Time) float64 {
+			return 20 + float64(int(t.Sub(start).Seconds())%70)
+		}
+		startMissionConfig(t, button, test.config)
+		c.now = c.now.Add(test.elapsed)
+		want, err := button.ReadLog()
+		if err != nil {
+			t.Fatalf("ReadLog() = %v", err)
+		}
+
+		reader, err := button.NewSampleReader(context.Background())
+		if err != nil {
+			t.Fatalf("NewSampleReader() = %v", err)
+		}
+		reader.Chunk = test.chunk
+		calls, read, total := 0, 0, 0
+		reader.Progress = func(r, t int) {
+			calls++
+			read, total = r, t
+		}
+		if x := reader.Len(); x != len(want) {
+			t.Errorf("%+v: Len() = %v, want %v", test.config, x, len(want))
+		}
+
+		for i := 0; ; i++ {
+			sample, err := reader.Next()
+			if err == io.EOF {
+				if i != len(want) {
+					t.Errorf("%+v: %v samples, want %v", test.config, i, len(want))
+				}
+				break
+			}
+			if err != nil {
+				t.Fatalf("Next() = %v", err)
+			}
+			if i >= len(want) {
+				t.Fatalf("%+v: extra sample %v = %+v, want %v samples", test.config, i, sample, len(want))
+			}
+			if sample != want[i] {
+				t.Fatalf("%+v: sample %v = %+v, want %+v", test.config, i, sample, want[i])
+			}
+		}
+		// progress is reported page by page, whatever the chunk size
+		if calls != test.pages || read != test.pages || total != test.pages {
+			t.Errorf("%+v: %v progress calls, last %v/%v pages, want %v calls, last %v/%v", test.config,
+				calls, read, total, test.pages, test.pages, test.pages)
+		}
+	}
+}
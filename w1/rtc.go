@@ -0,0 +1,100 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"time"
+)
+
+// RTC register bits (hours and month register)
+const (
+	RTC_12_HOUR = 0x40
+	RTC_PM      = 0x20
+	RTC_CENTURY = 0x80
+)
+
+// bcd encodes the given value (0-99) as binary coded decimal
+func bcd(value int) byte {
+
+	return byte(value/10<<4 | value%10)
+}
+
+// unbcd decodes the given binary coded decimal
+func unbcd(value byte) int {
+
+	return int(value>>4)*10 + int(value&0x0F)
+}
+
+// encodeRTC encodes the wall clock of the given time into the 6 byte RTC
+// register format (seconds, minutes, hours, date, month, year), in 12 or 24
+// hour mode. Years from 2100 on set the century bit.
+func encodeRTC(t time.Time, hour12 bool) (bytes []byte) {
+
+	bytes = make([]byte, 6)
+	bytes[0] = bcd(t.Second())
+	bytes[1] = bcd(t.Minute())
+	bytes[3] = bcd(t.Day())
+	bytes[4] = bcd(int(t.Month()))
+	bytes[5] = bcd(t.Year() % 100)
+
+	if hour12 {
+		hour := t.Hour() % 12
+		if hour == 0 {
+			hour = 12
+		}
+		bytes[2] = RTC_12_HOUR | bcd(hour)
+		if t.Hour() >= 12 {
+			bytes[2] |= RTC_PM
+		}
+	} else {
+		bytes[2] = bcd(t.Hour())
+	}
+
+	if t.Year() >= 2100 {
+		bytes[4] |= RTC_CENTURY
+	}
+
+	return
+}
+
+// decodeRTC decodes the 6 byte RTC register format as a wall clock time in
+// the given location. The device has no notion of time zones, so the location
+// must be the one the clock was set in.
+func decodeRTC(bytes []byte, location *time.Location) time.Time {
+
+	year := 2000 + unbcd(bytes[5])
+	if bytes[4]&RTC_CENTURY != 0 {
+		year += 100
+	}
+	month := time.Month(unbcd(bytes[4] & 0x1F))
+	day := unbcd(bytes[3] & 0x3F)
+	minute := unbcd(bytes[1] & 0x7F)
+	second := unbcd(bytes[0] & 0x7F)
+
+	var hour int
+	if bytes[2]&RTC_12_HOUR != 0 {
+		hour = unbcd(bytes[2]&0x1F) % 12
+		if bytes[2]&RTC_PM != 0 {
+			hour += 12
+		}
+	} else {
+		hour = unbcd(bytes[2] & 0x3F)
+	}
+
+	return time.Date(year, month, day, hour, minute, second, 0, location)
+}
@@ -0,0 +1,107 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"github.com/maxhille/go-ibutton/w1"
+	"testing"
+	"time"
+)
+
+func TestClock(t *testing.T) {
+	tests := []struct {
+		clock  time.Time
+		hour12 bool
+		after  time.Duration
+	}{
+		{time.Date(2013, 4, 1, 15, 30, 0, 0, time.UTC), false, 0},
+		{time.Date(2013, 4, 1, 15, 30, 0, 0, time.UTC), true, 0},
+		{time.Date(2013, 4, 1, 0, 30, 0, 0, time.UTC), true, 0},
+		{time.Date(2013, 4, 1, 12, 30, 0, 0, time.UTC), true, 0},
+		{time.Date(2013, 4, 1, 11, 59, 59, 0, time.UTC), true, time.Second},
+		{time.Date(2013, 4, 1, 23, 59, 59, 0, time.UTC), true, time.Second},
+		{time.Date(2013, 12, 31, 23, 59, 59, 0, time.UTC), false, time.Second},
+		{time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC), false, 2 * time.Second},
+		{time.Date(2099, 12, 31, 23, 59, 59, 0, time.UTC), true, 2 * time.Second},
+		{time.Date(2150, 6, 15, 21, 5, 0, 0, time.UTC), true, 0},
+	}
+
+	for _, location := range []*time.Location{time.UTC, time.FixedZone("UTC+2", 2*60*60)} {
+		for _, test := range tests {
+			button, device, c := newButton(w1.DS1922L)
+			button.SetLocation(location)
+			device.SetClock(test.clock, test.hour12)
+			c.now = c.now.Add(test.after)
+
+			status, err := button.Status()
+			if err != nil {
+				t.Fatalf("Status() = %v", err)
+			}
+			wall := test.clock.Add(test.after)
+			want := time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), 0, location)
+			if x := status.Time(); !x.Equal(want) || x.Location() != location {
+				t.Errorf("clock %v (12h: %v) + %v: Time() = %v, want %v", test.clock, test.hour12, test.after, x, want)
+			}
+		}
+	}
+}
+
+func TestClockLocation(t *testing.T) {
+	button, device, _ := newButton(w1.DS1922L)
+	device.SetClock(time.Date(2013, 4, 1, 15, 30, 0, 0, time.UTC), false)
+	button.SetLocation(time.FixedZone("UTC+2", 2*60*60))
+
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if x, want := status.Time().UTC(), time.Date(2013, 4, 1, 13, 30, 0, 0, time.UTC); !x.Equal(want) {
+		t.Errorf("Time() = %v, want %v", x, want)
+	}
+}
+
+func TestSetClock(t *testing.T) {
+	for _, location := range []*time.Location{time.UTC, time.FixedZone("UTC-7", -7*60*60)} {
+		for _, hour12 := range []bool{false, true} {
+			button, device, c := newButton(w1.DS1922L)
+			button.SetLocation(location)
+			device.SetClock(time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), hour12)
+			startMission(t, button)
+
+			status, err := button.Status()
+			if err != nil {
+				t.Fatalf("Status() = %v", err)
+			}
+			if x := status.Time(); x.Location() != location || !x.Equal(c.now) {
+				t.Errorf("%v (12h: %v): Time() = %v, want %v", location, hour12, x, c.now.In(location))
+			}
+			if x := status.MissionTimestamp(); x.Location() != location || !x.Equal(c.now) {
+				t.Errorf("%v (12h: %v): MissionTimestamp() = %v, want %v", location, hour12, x, c.now.In(location))
+			}
+
+			// the clock keeps its hour mode
+			image, err := button.Dump()
+			if err != nil {
+				t.Fatalf("Dump() = %v", err)
+			}
+			if x := image.Memory[0x0202]&w1.RTC_12_HOUR != 0; x != hour12 {
+				t.Errorf("%v: 12 hour mode = %v after mission start, want %v", location, x, hour12)
+			}
+		}
+	}
+}
@@ -1,29 +1,59 @@
 package w1
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"time"
 )
 
 // Status represents an iButton status. The iButton's status is saved in two register pages (0x0200-0x0263)
 type Status struct {
-	bytes []byte
+	rom      ROM
+	bytes    []byte
+	location *time.Location
+	hostTime time.Time
+}
+
+// ROM the ROM id of the iButton the status was read from
+func (s *Status) ROM() ROM {
+
+	return s.rom
 }
 
 // Time the time
 func (s *Status) Time() time.Time {
 
-	return parseTime(s.bytes[0x00:0x06])
+	return decodeRTC(s.bytes[0x00:0x06], s.Location())
 
 }
 
-// MissionTimestamp the current mission timestamp
+// MissionTimestamp the time of the current mission's first sample, which
+// for SUTA missions is the first sample after the temperature alarm. The
+// zero time if the mission has not logged a sample yet (cleared registers).
 func (s *Status) MissionTimestamp() time.Time {
 
-	return parseTime(s.bytes[0x19:0x1F])
+	if bytes.Equal(s.bytes[0x19:0x1F], make([]byte, 6)) {
+		return time.Time{}
+	}
+
+	return decodeRTC(s.bytes[0x19:0x1F], s.Location())
 
 }
 
+// MissionID identifies the current mission of the iButton by the wall clock
+// time of the mission timestamp registers (0x0219-0x021E) as YYYYMMDDhhmmss,
+// independent of the time zone the clock is read in and sorting by mission
+// start. Empty if the mission has not logged a sample yet.
+func (s *Status) MissionID() string {
+
+	if s.MissionTimestamp().IsZero() {
+		return ""
+	}
+
+	return decodeRTC(s.bytes[0x19:0x1F], time.UTC).Format("20060102150405")
+}
+
 // decodeTemp gives the temperature encoded in the given byte slice
 func (s *Status) decodeTemp(bytes []byte) (temp Temperature) {
 
@@ -37,17 +67,20 @@ func (s *Status) decodeTemp(bytes []byte) (temp Temperature) {
 	return
 }
 
-// parseTime parses a time object from the given bytes
-func parseTime(bytes []byte) time.Time {
+// Location the time zone the iButton clock runs in
+func (s *Status) Location() *time.Location {
+
+	if s.location == nil {
+		return time.Local
+	}
+
+	return s.location
+}
 
-	year := int(2000) + int(bytes[5]&0x0f) + int(bytes[5]>>4)*10
-	month := int(bytes[4]&0x0f) + int(bytes[4]>>4)*10
-	day := int(bytes[3]&0x0f) + int(bytes[3]>>4)*10
-	hour := int(bytes[2]&0x0f) + int(bytes[2]>>4)&3*10
-	minute := int(bytes[1]&0x0f) + int(bytes[1]>>4)*10
-	second := int(bytes[0]&0x0f) + int(bytes[0]>>4)*10
+// hour12 true if the iButton clock runs in 12 hour mode
+func (s *Status) hour12() bool {
 
-	return time.Date(year, time.Month(month), day, hour, minute, second, 0, time.Local)
+	return s.bytes[0x02]&RTC_12_HOUR != 0
 }
 
 // SampleCount count of recorded samples since last mission start
@@ -62,12 +95,128 @@ func (s *Status) MissionInProgress() bool {
 	return s.bytes[0x15]&(0x01<<1) > 0
 }
 
+// StartDelay the time left until the first sample of a delayed mission, in whole minutes
+func (s *Status) StartDelay() time.Duration {
+
+	delay := uint32(s.bytes[0x18])<<16 + uint32(s.bytes[0x17])<<8 + uint32(s.bytes[0x16])
+
+	return time.Duration(delay) * time.Minute
+}
+
+// WaitingToStart true if a mission was started but its start delay has not
+// run out yet. MissionInProgress is true for waiting missions as well.
+func (s *Status) WaitingToStart() bool {
+
+	return s.MissionInProgress() && s.StartDelay() > 0
+}
+
+// StartUponAlarm true if the mission holds off logging until a temperature alarm (SUTA==1)
+func (s *Status) StartUponAlarm() bool {
+
+	return s.bytes[0x13]&(0x01<<5) > 0
+}
+
+// WaitingForAlarm true if a SUTA mission is running but no temperature alarm
+// occurred yet (WFTA==1). MissionInProgress is true for waiting missions as well.
+func (s *Status) WaitingForAlarm() bool {
+
+	return s.MissionInProgress() && s.bytes[0x15]&(0x01<<4) > 0
+}
+
 // HighResolution true if the chip is in 16bit (0.0625°C) mode
 func (s *Status) HighResolution() bool {
 
 	return s.bytes[0x13]&(0x01<<2) > 0
 }
 
+// TemperatureLogging true if the mission logs temperatures (ETL==1)
+func (s *Status) TemperatureLogging() bool {
+
+	return s.bytes[0x13]&(0x01<<0) > 0
+}
+
+// HumidityLogging true if the mission logs humidities (EHL==1)
+func (s *Status) HumidityLogging() bool {
+
+	return s.bytes[0x13]&(0x01<<1) > 0
+}
+
+// HumidityHighResolution true if humidities are logged in 16bit mode (HLFS==1)
+func (s *Status) HumidityHighResolution() bool {
+
+	return s.bytes[0x13]&(0x01<<3) > 0
+}
+
+// Rollover true if the oldest samples get overwritten once the log memory is full (RO==1)
+func (s *Status) Rollover() bool {
+
+	return s.bytes[0x13]&(0x01<<4) > 0
+}
+
+// RolledOver true if the log memory wrapped around and lost the oldest samples
+func (s *Status) RolledOver() bool {
+
+	return s.Rollover() && s.SampleCount() > s.Capacity()
+}
+
+// logWindow returns the index of the oldest sample still in the log memory
+// and the number of samples in the log memory
+func (s *Status) logWindow() (first uint32, count uint32) {
+
+	count = s.SampleCount()
+	if count <= s.Capacity() {
+		return 0, count
+	}
+
+	// without rollover logging stops once the memory is full
+	if !s.Rollover() {
+		return 0, s.Capacity()
+	}
+
+	return count - s.Capacity(), s.Capacity()
+}
+
+// sampleBytes the size of a temperature or humidity sample
+func (s *Status) sampleBytes(humidity bool) uint32 {
+
+	if humidity && s.HumidityHighResolution() || !humidity && s.HighResolution() {
+		return 2
+	}
+
+	return 1
+}
+
+// logAddress the start of the temperature or humidity log. The log memory
+// (0x1000-0x2FFF) is split in halves when both are logged.
+func (s *Status) logAddress(humidity bool) uint16 {
+
+	if humidity && s.TemperatureLogging() {
+		return 0x2000
+	}
+
+	return 0x1000
+}
+
+// Capacity the number of samples the log memory holds for the mission's
+// channels and resolutions
+func (s *Status) Capacity() uint32 {
+
+	size := uint32(0x2000)
+	if s.TemperatureLogging() && s.HumidityLogging() {
+		size /= 2
+	}
+
+	capacity := size
+	if s.TemperatureLogging() {
+		capacity = size / s.sampleBytes(false)
+	}
+	if s.HumidityLogging() && size/s.sampleBytes(true) < capacity {
+		capacity = size / s.sampleBytes(true)
+	}
+
+	return capacity
+}
+
 // SampleRate return the currently set sample rate
 func (s *Status) SampleRate() (duration time.Duration) {
 
@@ -84,6 +233,36 @@ func (s *Status) SampleRate() (duration time.Duration) {
 	return
 }
 
+// LowAlarm the low temperature alarm threshold
+func (s *Status) LowAlarm() Temperature {
+
+	return s.decodeTemp(s.bytes[0x08:0x09])
+}
+
+// HighAlarm the high temperature alarm threshold
+func (s *Status) HighAlarm() Temperature {
+
+	return s.decodeTemp(s.bytes[0x09:0x0A])
+}
+
+// LowAlarmEnabled true if the low temperature alarm is enabled (ETLA==1)
+func (s *Status) LowAlarmEnabled() bool {
+
+	return s.bytes[0x10]&(0x01<<0) > 0
+}
+
+// HighAlarmEnabled true if the high temperature alarm is enabled (ETHA==1)
+func (s *Status) HighAlarmEnabled() bool {
+
+	return s.bytes[0x10]&(0x01<<1) > 0
+}
+
+// Alarms the alarms which occurred during the mission
+func (s *Status) Alarms() Alarm {
+
+	return Alarm(s.bytes[0x14] & 0x1F)
+}
+
 // MemoryCleared true when the memory has been successfully cleared (MEMCLR==1)
 func (s *Status) MemoryCleared() bool {
 
@@ -91,6 +270,12 @@ func (s *Status) MemoryCleared() bool {
 }
 
 
+// PasswordsEnabled true if password protection is enabled
+func (s *Status) PasswordsEnabled() bool {
+
+	return s.bytes[0x27] == PASSWORDS_ENABLED
+}
+
 // DeviceId the device identifier byte
 func (s *Status) DeviceId() (model deviceId) {
 
@@ -113,13 +298,30 @@ func (s *Status) correctionFactors() (a Temperature, b Temperature, c Temperatur
 	err1 := err2
 
 	// formula stuff from DS1922L data sheet (p.50)
-	b = (tr2*tr2 - tr1*tr1) * (err3 - err1) / ((tr2*tr2-tr1*tr1)*(tr3-tr1) + (tr3*tr3-tr1*tr1)*(tr1-tr2))
-	a = b * (tr1 - tr2) / (tr2*tr2 - tr1*tr1)
-	c = err1 - a*tr1*tr1 - b*tr1
+	fa, fb, fc := quadratic(float32(tr1), float32(err1), float32(tr2), float32(err2), float32(tr3), float32(err3))
+
+	return Temperature(fa), Temperature(fb), Temperature(fc)
+}
+
+// quadratic returns the factors of the error function a*r*r + b*r + c
+// through the three given reference values and their errors
+func quadratic(r1, err1, r2, err2, r3, err3 float32) (a, b, c float32) {
+
+	b = ((r2*r2-r1*r1)*(err3-err1) + (r3*r3-r1*r1)*(err1-err2)) / ((r2*r2-r1*r1)*(r3-r1) + (r3*r3-r1*r1)*(r1-r2))
+	a = (err2 - err1 - b*(r2-r1)) / (r2*r2 - r1*r1)
+	c = err1 - a*r1*r1 - b*r1
 
 	return
 }
 
+// TemperatureRange the device model's operating temperature range
+func (s *Status) TemperatureRange() (min Temperature, max Temperature) {
+
+	device := devices[s.DeviceId()]
+
+	return device.min, device.max
+}
+
 // Name the device model's name
 func (s *Status) Name() string {
 
@@ -130,3 +332,73 @@ func (s *Status) Name() string {
 
 	return fmt.Sprintf("Unknown Device (deviceId:%x)", s.DeviceId())
 }
+
+// statusAlarm is the JSON representation of an alarm threshold
+type statusAlarm struct {
+	Threshold Temperature `json:"threshold"`
+	Enabled   bool        `json:"enabled"`
+}
+
+// MarshalJSON encodes all status fields as a JSON object
+func (s *Status) MarshalJSON() ([]byte, error) {
+
+	resolution := 0.5
+	if s.HighResolution() {
+		resolution = 0.0625
+	}
+
+	var tripped []string
+	for _, alarm := range alarmNames {
+		if s.Alarms()&alarm.alarm != 0 {
+			tripped = append(tripped, alarm.name)
+		}
+	}
+
+	return json.Marshal(struct {
+		ROM                string      `json:"rom"`
+		Model              string      `json:"model"`
+		Time               time.Time   `json:"time"`
+		Drift              float64     `json:"clock_drift_seconds"`
+		MissionTimestamp   time.Time   `json:"mission_timestamp"`
+		SampleCount        uint32      `json:"sample_count"`
+		SampleRate         float64     `json:"sample_rate_seconds"`
+		Resolution         float64     `json:"resolution"`
+		TemperatureLogging bool        `json:"temperature_logging"`
+		HumidityLogging    bool        `json:"humidity_logging"`
+		Running            bool        `json:"running"`
+		WaitingToStart     bool        `json:"waiting_to_start"`
+		StartDelay         float64     `json:"start_delay_seconds"`
+		StartUponAlarm     bool        `json:"start_upon_alarm"`
+		WaitingForAlarm    bool        `json:"waiting_for_alarm"`
+		MemoryCleared      bool        `json:"memory_cleared"`
+		Rollover           bool        `json:"rollover"`
+		RolledOver         bool        `json:"rolled_over"`
+		PasswordsEnabled   bool        `json:"passwords_enabled"`
+		LowAlarm           statusAlarm `json:"low_alarm"`
+		HighAlarm          statusAlarm `json:"high_alarm"`
+		Alarms             []string    `json:"alarms"`
+	}{
+		ROM:                s.rom.String(),
+		Model:              s.Name(),
+		Time:               s.Time(),
+		Drift:              s.Drift().Seconds(),
+		MissionTimestamp:   s.MissionTimestamp(),
+		SampleCount:        s.SampleCount(),
+		SampleRate:         s.SampleRate().Seconds(),
+		Resolution:         resolution,
+		TemperatureLogging: s.TemperatureLogging(),
+		HumidityLogging:    s.HumidityLogging(),
+		Running:            s.MissionInProgress(),
+		WaitingToStart:     s.WaitingToStart(),
+		StartDelay:         s.StartDelay().Seconds(),
+		StartUponAlarm:     s.StartUponAlarm(),
+		WaitingForAlarm:    s.WaitingForAlarm(),
+		Rollover:           s.Rollover(),
+		RolledOver:         s.RolledOver(),
+		MemoryCleared:      s.MemoryCleared(),
+		PasswordsEnabled:   s.PasswordsEnabled(),
+		LowAlarm:           statusAlarm{s.LowAlarm(), s.LowAlarmEnabled()},
+		HighAlarm:          statusAlarm{s.HighAlarm(), s.HighAlarmEnabled()},
+		Alarms:             append([]string{}, tripped...),
+	})
+}
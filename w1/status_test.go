@@ -0,0 +1,94 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"encoding/json"
+	"github.com/maxhille/go-ibutton/w1"
+	"testing"
+	"time"
+)
+
+func TestStatusMarshalJSON(t *testing.T) {
+	button, _, c := newButton(w1.DS1922L)
+	config := w1.DefaultMissionConfig
+	config.HighAlarm, config.HighAlarmEnabled = 30, true
+	startMissionConfig(t, button, config)
+	c.now = c.now.Add(20 * time.Minute)
+
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	data, err := json.Marshal(status)
+	if err != nil {
+		t.Fatalf("json.Marshal() = %v", err)
+	}
+
+	var out struct {
+		ROM         string  `json:"rom"`
+		Model       string  `json:"model"`
+		SampleCount uint32  `json:"sample_count"`
+		SampleRate  float64 `json:"sample_rate_seconds"`
+		Resolution  float64 `json:"resolution"`
+		Running     bool    `json:"running"`
+		HighAlarm   struct {
+			Threshold float64 `json:"threshold"`
+			Enabled   bool    `json:"enabled"`
+		} `json:"high_alarm"`
+		Alarms []string `json:"alarms"`
+	}
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("json.Unmarshal(%s) = %v", data, err)
+	}
+	if out.ROM != button.ROM().String() || out.Model != "DS1922L" || out.SampleCount != 3 ||
+		out.SampleRate != 600 || out.Resolution != 0.0625 || !out.Running ||
+		out.HighAlarm.Threshold != 30 || !out.HighAlarm.Enabled || len(out.Alarms) != 0 {
+		t.Errorf("json.Marshal(status) = %s", data)
+	}
+}
+
+func TestMissionID(t *testing.T) {
+	button, _, _ := newButton(w1.DS1922L)
+	status, err := button.Status()
+	if err != nil {
+		t.Fatalf("Status() = %v", err)
+	}
+	if x := status.MissionID(); x != "" {
+		t.Errorf("MissionID() before the first sample = %q, want none", x)
+	}
+
+	// the same mission in any time zone and hour mode, sorting by start
+	for _, hour12 := range []bool{false, true} {
+		button, device, c := newButton(w1.DS1922L)
+		device.SetClock(c.now, hour12)
+		startMission(t, button)
+		c.now = c.now.Add(20 * time.Minute)
+
+		for _, location := range []*time.Location{time.UTC, time.FixedZone("UTC-7", -7*60*60)} {
+			button.SetLocation(location)
+			status, err := button.Status()
+			if err != nil {
+				t.Fatalf("Status() = %v", err)
+			}
+			if x := status.MissionID(); x != "20130401153000" {
+				t.Errorf("MissionID() in %v (12h: %v) = %q, want 20130401153000", location, hour12, x)
+			}
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// SysfsTransport is a Transport using the Linux w1 sysfs driver. The kernel
+// resets the bus and addresses the slave on every write to its rw file, so
+// each command has to be sent with a single Write.
+type SysfsTransport struct {
+
+	// Dir is the w1 devices directory, W1_DIR if empty
+	Dir string
+
+	file *os.File
+	rom  ROM
+}
+
+// dir the w1 devices directory
+func (t *SysfsTransport) dir() string {
+
+	if t.Dir == "" {
+		return W1_DIR
+	}
+
+	return t.Dir
+}
+
+// Search lists the ROM ids of all devices the kernel found on the bus
+func (t *SysfsTransport) Search() (roms []ROM, err error) {
+
+	// open devices directory
+	dir, err := os.Open(t.dir())
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+
+	// get devices directory contents
+	names, err := dir.Readdirnames(0)
+	if err != nil {
+		return
+	}
+
+	// skip bus masters and everything else which is not a slave
+	for _, name := range names {
+		rom, err := ParseROM(name)
+		if err != nil {
+			continue
+		}
+		roms = append(roms, rom)
+	}
+
+	return
+}
+
+// Reset sends an empty write, which makes the kernel reset the bus
+func (t *SysfsTransport) Reset() (err error) {
+
+	if t.file == nil {
+		return
+	}
+
+	_, err = t.file.Write(make([]byte, 0))
+
+	return
+}
+
+// Select opens the given device's rw file
+func (t *SysfsTransport) Select(rom ROM) (err error) {
+
+	if t.file != nil && t.rom == rom {
+		return
+	}
+
+	err = t.Close()
+	if err != nil {
+		return
+	}
+
+	t.file, err = os.OpenFile(t.dir()+"/"+rom.String()+"/rw", os.O_RDWR, 0666)
+	if err != nil {
+		t.file = nil
+		return
+	}
+	t.rom = rom
+
+	return
+}
+
+// Write writes to the selected device's rw file
+func (t *SysfsTransport) Write(data []byte) (err error) {
+
+	if t.file == nil {
+		return errors.New("no 1-Wire device selected")
+	}
+
+	_, err = t.file.Write(data)
+
+	return
+}
+
+// Read reads from the selected device's rw file
+func (t *SysfsTransport) Read(data []byte) (err error) {
+
+	if t.file == nil {
+		return errors.New("no 1-Wire device selected")
+	}
+
+	_, err = io.ReadFull(t.file, data)
+
+	return
+}
+
+// Close closes the selected device's rw file
+func (t *SysfsTransport) Close() (err error) {
+
+	if t.file == nil {
+		return
+	}
+
+	err = t.file.Close()
+	t.file = nil
+
+	return
+}
@@ -0,0 +1,97 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1
+
+import (
+	"fmt"
+	"github.com/maxhille/go-ibutton/crc8"
+	"strconv"
+)
+
+// Transport is a 1-Wire bus master. A Button issues all of its commands
+// through a Transport, so other bus masters or fakes can be plugged in.
+type Transport interface {
+
+	// Reset resets the bus, which terminates the command in progress
+	Reset() error
+
+	// Search returns the ROM ids of all devices on the bus
+	Search() ([]ROM, error)
+
+	// Select resets the bus and addresses the device with the given ROM id
+	Select(rom ROM) error
+
+	// Write sends the given bytes to the selected device
+	Write(data []byte) error
+
+	// Read fills the given buffer with bytes from the selected device
+	Read(data []byte) error
+
+	// Close releases the bus master
+	Close() error
+}
+
+// ROM is a 1-Wire device's 64 bit registration number: family code,
+// 48 bit serial number (least significant byte first) and CRC8
+type ROM [8]byte
+
+// ParseROM parses a ROM id in the w1 sysfs notation (e.g. "41-00000012ab34")
+func ParseROM(s string) (rom ROM, err error) {
+
+	if len(s) != 15 || s[2] != '-' {
+		return rom, fmt.Errorf("invalid ROM id %q", s)
+	}
+	family, err := strconv.ParseUint(s[:2], 16, 8)
+	if err != nil {
+		return rom, fmt.Errorf("invalid ROM id %q", s)
+	}
+	serial, err := strconv.ParseUint(s[3:], 16, 48)
+	if err != nil {
+		return rom, fmt.Errorf("invalid ROM id %q", s)
+	}
+
+	rom[0] = byte(family)
+	for i := 1; i < 7; i++ {
+		rom[i] = byte(serial >> (uint(i-1) * 8))
+	}
+	rom[7] = crc8.Checksum(rom[:7])
+
+	return
+}
+
+// Family the device family code
+func (r ROM) Family() byte {
+
+	return r[0]
+}
+
+// Serial the device's 48 bit serial number
+func (r ROM) Serial() (serial uint64) {
+
+	for i := 6; i > 0; i-- {
+		serial = serial<<8 | uint64(r[i])
+	}
+
+	return
+}
+
+// String formats the ROM id in the w1 sysfs notation
+func (r ROM) String() string {
+
+	return fmt.Sprintf("%02x-%012x", r.Family(), r.Serial())
+}
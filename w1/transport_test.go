@@ -0,0 +1,42 @@
+// This file is part of ibutton.
+//
+// Copyright (C) 2013 Max Hille <mh@lambdasoup.com>
+//
+// ibutton is free software: you can redistribute it and/or modify
+// it under the terms of the GNU General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// at your option) any later version.
+//
+// ibutton is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE.  See the
+// GNU General Public License for more details.
+//
+// You should have received a copy of the GNU General Public License
+// along with ibutton.  If not, see <http://www.gnu.org/licenses/>.
+
+package w1_test
+
+import (
+	"github.com/maxhille/go-ibutton/w1"
+	"testing"
+)
+
+func TestParseROM(t *testing.T) {
+	rom, err := w1.ParseROM("41-00000012ab34")
+	if err != nil {
+		t.Fatalf("ParseROM() = %v", err)
+	}
+	if x := (w1.ROM{0x41, 0x34, 0xab, 0x12, 0x00, 0x00, 0x00, rom[7]}); rom != x {
+		t.Errorf("ParseROM(\"41-00000012ab34\") = %v, want %v", rom, x)
+	}
+	if x := rom.String(); x != "41-00000012ab34" {
+		t.Errorf("String() = %v, want 41-00000012ab34", x)
+	}
+
+	for _, id := range []string{"w1_bus_master1", "41-12ab34", "41_00000012ab34", "xx-00000012ab34"} {
+		if _, err := w1.ParseROM(id); err == nil {
+			t.Errorf("ParseROM(%q) = nil, want error", id)
+		}
+	}
+}